@@ -0,0 +1,87 @@
+package config
+
+import (
+	"errors"
+	"strings"
+)
+
+// 示例配置中的占位密钥，不能用于生产环境
+var placeholderSecrets = map[string]bool{
+	"your-secret-key":              true,
+	"your-session-secret-key-here": true,
+	"your-vault-key":               true,
+	"your-link-secret":             true,
+}
+
+// AppConfig 应用配置
+type AppConfig struct {
+	BaseURL       string // 对外访问地址，用于生成邮件中的链接
+	SessionSecret string
+	LinkSecret    string   // 邮件中签到、退订链接的签名密钥，必须单独配置
+	VaultKey      string   // 遗言消息和两步验证密钥的加密密钥，必须单独配置，更换后已有数据将无法解密
+	AdminUsers    []string // 管理员用户名，可以管理邮件模板
+	Env           string   // 运行环境，development时启用开发辅助页面
+	TOTPIssuer    string   // 两步验证在验证器中显示的名称
+}
+
+// IsDevelopment 是否为开发环境
+func (c AppConfig) IsDevelopment() bool {
+	return c.Env == "development"
+}
+
+// GetAppConfig 获取应用配置
+func GetAppConfig() AppConfig {
+	return AppConfig{
+		BaseURL:       strings.TrimRight(getEnv("APP_BASE_URL", "http://localhost:"+getEnv("SERVER_PORT", "8080")), "/"),
+		SessionSecret: getEnv("SESSION_SECRET", "your-secret-key"),
+		LinkSecret:    getEnv("LINK_SECRET", ""),
+		VaultKey:      getEnv("VAULT_KEY", ""),
+		AdminUsers:    splitList(getEnv("ADMIN_USERS", "")),
+		Env:           strings.ToLower(getEnv("APP_ENV", "production")),
+		TOTPIssuer:    getEnv("TOTP_ISSUER", "签到系统"),
+	}
+}
+
+// Validate 检查应用配置，返回的错误列出所有问题
+// 开发环境允许不配置VAULT_KEY和LINK_SECRET，由调用方回退到开发用密钥
+func (c AppConfig) Validate() error {
+	var problems []string
+
+	switch {
+	case c.VaultKey == "":
+		if !c.IsDevelopment() {
+			problems = append(problems, "VAULT_KEY is required")
+		}
+	case placeholderSecrets[c.VaultKey]:
+		problems = append(problems, "VAULT_KEY must not be the example value")
+	case c.VaultKey == c.SessionSecret:
+		problems = append(problems, "VAULT_KEY must be different from SESSION_SECRET")
+	}
+
+	switch {
+	case c.LinkSecret == "":
+		if !c.IsDevelopment() {
+			problems = append(problems, "LINK_SECRET is required")
+		}
+	case placeholderSecrets[c.LinkSecret]:
+		problems = append(problems, "LINK_SECRET must not be the example value")
+	case c.LinkSecret == c.SessionSecret || c.LinkSecret == c.VaultKey:
+		problems = append(problems, "LINK_SECRET must be different from SESSION_SECRET and VAULT_KEY")
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// splitList 解析逗号分隔的列表，忽略空项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,43 +1,200 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SMTP连接的TLS模式
+const (
+	SMTPTLSStartTLS = "starttls" // 明文连接后必须通过STARTTLS升级，通常使用587端口
+	SMTPTLSImplicit = "implicit" // 连接建立即使用TLS，通常使用465端口
+	SMTPTLSNone     = "none"     // 不使用TLS，仅适用于本机的中继；配置了密码时只允许连接localhost
+)
+
+// 邮件发送方式，除smtp外均用于本地开发和测试
+const (
+	MailTransportSMTP   = "smtp"   // 通过SMTP服务器发送
+	MailTransportFile   = "file"   // 每封邮件写入目录下的.eml文件
+	MailTransportStdout = "stdout" // 输出到标准输出
+	MailTransportMemory = "memory" // 保存在内存中，重启后丢失
 )
 
 // EmailConfig 邮件配置
 type EmailConfig struct {
+	Transport    string // 发送方式，默认smtp
+	FileDir      string // file方式保存邮件的目录
 	SMTPHost     string
-	SMTPPort     string
-	SMTPEmail    string
+	SMTPPort     int
+	SMTPEmail    string // SMTP认证用户名，为空时不进行认证（如内网中继）
 	SMTPPassword string
+	TLSMode      string // starttls、implicit或none
+	SkipVerify   bool   // 跳过服务器证书校验，仅用于自签名证书的测试环境
+	FromName     string // 发件人显示名称
+	FromAddress  string // 发件人地址，未配置时使用SMTPEmail
+	PoolSize     int    // 保持的空闲SMTP连接数，集中发送时复用连接
+
+	problems []string // 解析环境变量时发现的问题，由Validate报告
 }
 
 // GetEmailConfig 获取邮件配置
 func GetEmailConfig() EmailConfig {
-	return EmailConfig{
+	cfg := EmailConfig{
+		Transport:    strings.ToLower(getEnv("MAIL_TRANSPORT", MailTransportSMTP)),
+		FileDir:      getEnv("MAIL_FILE_DIR", filepath.Join("tmp", "mail")),
 		SMTPHost:     getEnv("SMTP_HOST", "smtp.gmail.com"),
-		SMTPPort:     getEnv("SMTP_PORT", "587"),
 		SMTPEmail:    getEnv("SMTP_EMAIL", ""),
 		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		TLSMode:      strings.ToLower(getEnv("SMTP_TLS_MODE", "")),
+		FromName:     getEnv("SMTP_FROM_NAME", ""),
+		PoolSize:     2,
+	}
+	cfg.FromAddress = getEnv("SMTP_FROM_ADDRESS", cfg.SMTPEmail)
+	if cfg.FromAddress == "" && cfg.Transport != MailTransportSMTP {
+		// 开发用的发送方式不需要真实的发件人
+		cfg.FromAddress = "checkin@localhost"
+	}
+
+	if port := getEnv("SMTP_PORT", ""); port != "" {
+		if n, err := strconv.Atoi(port); err == nil {
+			cfg.SMTPPort = n
+		} else {
+			cfg.problems = append(cfg.problems, fmt.Sprintf("SMTP_PORT %q is not a number", port))
+		}
+	}
+
+	// 未指定TLS模式时按端口推断：465使用隐式TLS，其余使用STARTTLS
+	if cfg.TLSMode == "" {
+		cfg.TLSMode = SMTPTLSStartTLS
+		if cfg.SMTPPort == 465 {
+			cfg.TLSMode = SMTPTLSImplicit
+		}
+	}
+
+	// 未指定端口时使用TLS模式对应的标准端口
+	if cfg.SMTPPort == 0 && len(cfg.problems) == 0 {
+		switch cfg.TLSMode {
+		case SMTPTLSImplicit:
+			cfg.SMTPPort = 465
+		case SMTPTLSNone:
+			cfg.SMTPPort = 25
+		default:
+			cfg.SMTPPort = 587
+		}
+	}
+
+	if value := getEnv("SMTP_SKIP_VERIFY", ""); value != "" {
+		if skip, err := strconv.ParseBool(value); err == nil {
+			cfg.SkipVerify = skip
+		} else {
+			cfg.problems = append(cfg.problems, fmt.Sprintf("SMTP_SKIP_VERIFY %q is not a boolean", value))
+		}
+	}
+
+	if value := getEnv("SMTP_POOL_SIZE", ""); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			cfg.PoolSize = n
+		} else {
+			cfg.problems = append(cfg.problems, fmt.Sprintf("SMTP_POOL_SIZE %q must be a non-negative number", value))
+		}
+	}
+
+	return cfg
+}
+
+// Validate 检查邮件配置，返回的错误列出所有问题，便于启动时一次性修正
+// 只有smtp方式需要检查SMTP相关配置
+func (c EmailConfig) Validate() error {
+	switch c.Transport {
+	case MailTransportSMTP:
+	case MailTransportFile:
+		if c.FileDir == "" {
+			return errors.New("MAIL_FILE_DIR must be set when MAIL_TRANSPORT=file")
+		}
+		return nil
+	case MailTransportStdout, MailTransportMemory:
+		return nil
+	default:
+		return fmt.Errorf("MAIL_TRANSPORT %q is invalid, use smtp, file, stdout or memory", c.Transport)
+	}
+
+	problems := append([]string(nil), c.problems...)
+
+	if c.SMTPHost == "" {
+		problems = append(problems, "SMTP_HOST must be set")
 	}
+	if c.SMTPPort < 0 || c.SMTPPort > 65535 || (c.SMTPPort == 0 && len(c.problems) == 0) {
+		problems = append(problems, fmt.Sprintf("SMTP_PORT %d is out of range 1-65535", c.SMTPPort))
+	}
+
+	switch c.TLSMode {
+	case SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone:
+	default:
+		problems = append(problems, fmt.Sprintf("SMTP_TLS_MODE %q is invalid, use starttls, implicit or none", c.TLSMode))
+	}
+
+	if c.SMTPPassword != "" && c.SMTPEmail == "" {
+		problems = append(problems, "SMTP_PASSWORD is set but SMTP_EMAIL (the login username) is empty")
+	}
+
+	// 不加密时密码以明文传输，只允许连接本机的中继
+	if c.TLSMode == SMTPTLSNone && c.SMTPPassword != "" && c.SMTPHost != "" && !isLocalHost(c.SMTPHost) {
+		problems = append(problems, fmt.Sprintf("SMTP_TLS_MODE=none sends SMTP_PASSWORD in plain text, it is only allowed for a relay on localhost, not %q", c.SMTPHost))
+	}
+
+	if c.FromAddress == "" {
+		problems = append(problems, "SMTP_FROM_ADDRESS or SMTP_EMAIL must be set")
+	} else if addr, err := mail.ParseAddress(c.FromAddress); err != nil || addr.Address != c.FromAddress {
+		problems = append(problems, fmt.Sprintf("SMTP_FROM_ADDRESS %q is not a valid email address", c.FromAddress))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// isLocalHost 检查SMTP主机是否为本机
+func isLocalHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
 
 // EmailTemplate 邮件模板
+// Body为纯文本正文，HTML为可选的HTML正文，提供时以multipart/alternative发送
+// HTML正文使用html/template渲染，嵌入email_layouts中的公共布局，可以使用其中定义的局部模板
+// Locales为按语言标签（如 en、zh-TW）提供的变体，选择时按 zh-TW → zh → 默认 的顺序回退
 type EmailTemplate struct {
-	Subject string `json:"subject"`
-	Body    string `json:"body"`
+	Subject string                   `json:"subject"`
+	Body    string                   `json:"body"`
+	HTML    string                   `json:"html,omitempty"`
+	Locales map[string]EmailTemplate `json:"locales,omitempty"`
 }
 
+// EmailLayoutDir HTML邮件公共布局和局部模板目录
+// 目录下的*.html为默认布局，以语言标签命名的子目录（如 en/）中的文件会覆盖同名模板定义
+var EmailLayoutDir = filepath.Join("config", "email_layouts")
+
 // EmailTemplates 邮件模板集合
 type EmailTemplates map[string]EmailTemplate
 
+// EmailTemplatesPath 邮件模板文件
+var EmailTemplatesPath = filepath.Join("config", "email_templates.json")
+
 // LoadEmailTemplates 加载邮件模板
 func LoadEmailTemplates() (EmailTemplates, error) {
-	configPath := filepath.Join("config", "email_templates.json")
-	
-	data, err := os.ReadFile(configPath)
+	data, err := os.ReadFile(EmailTemplatesPath)
 	if err != nil {
 		return nil, err
 	}
@@ -52,13 +209,20 @@ func LoadEmailTemplates() (EmailTemplates, error) {
 }
 
 // SaveEmailTemplates 保存邮件模板
+// 先写入临时文件再重命名，避免监视文件的进程读到写了一半的内容
 func SaveEmailTemplates(templates EmailTemplates) error {
-	configPath := filepath.Join("config", "email_templates.json")
-	
-	data, err := json.MarshalIndent(templates, "", "  ")
-	if err != nil {
+	// 保留HTML正文中的<>&，便于直接编辑文件
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(templates); err != nil {
 		return err
 	}
-	
-	return os.WriteFile(configPath, data, 0644)
+
+	tmpPath := EmailTemplatesPath + ".tmp"
+	if err := os.WriteFile(tmpPath, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, EmailTemplatesPath)
 }
\ No newline at end of file
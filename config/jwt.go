@@ -0,0 +1,76 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// jwtMinSecretBytes HS256签名密钥的最少字节数
+const jwtMinSecretBytes = 32
+
+// JWTConfig JWT认证配置，未设置JWT_SECRET时不启用JWT模式，只使用Session认证
+type JWTConfig struct {
+	Secret     string        // HS256签名密钥
+	AccessTTL  time.Duration // 访问令牌有效期
+	RefreshTTL time.Duration // 刷新令牌有效期，每次刷新后重新计算
+
+	problems []string // 解析环境变量时发现的问题，由Validate报告
+}
+
+// GetJWTConfig 获取JWT认证配置
+func GetJWTConfig() JWTConfig {
+	cfg := JWTConfig{
+		Secret:     getEnv("JWT_SECRET", ""),
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: 30 * 24 * time.Hour,
+	}
+
+	if value := getEnv("JWT_ACCESS_TTL", ""); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			cfg.AccessTTL = d
+		} else {
+			cfg.problems = append(cfg.problems, fmt.Sprintf("JWT_ACCESS_TTL %q is not a duration", value))
+		}
+	}
+
+	if value := getEnv("JWT_REFRESH_TTL", ""); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			cfg.RefreshTTL = d
+		} else {
+			cfg.problems = append(cfg.problems, fmt.Sprintf("JWT_REFRESH_TTL %q is not a duration", value))
+		}
+	}
+
+	return cfg
+}
+
+// Enabled 是否启用JWT模式
+func (c JWTConfig) Enabled() bool {
+	return c.Secret != ""
+}
+
+// Validate 检查JWT配置，未启用时不做检查，返回的错误列出所有问题
+func (c JWTConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	problems := append([]string(nil), c.problems...)
+
+	if len(c.Secret) < jwtMinSecretBytes {
+		problems = append(problems, fmt.Sprintf("JWT_SECRET must be at least %d bytes", jwtMinSecretBytes))
+	}
+	if c.AccessTTL < time.Minute || c.AccessTTL > 24*time.Hour {
+		problems = append(problems, fmt.Sprintf("JWT_ACCESS_TTL %s is out of range 1m-24h", c.AccessTTL))
+	}
+	if c.RefreshTTL <= c.AccessTTL {
+		problems = append(problems, fmt.Sprintf("JWT_REFRESH_TTL %s must be longer than JWT_ACCESS_TTL", c.RefreshTTL))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordMaxBytes bcrypt只使用密码的前72个字节，更长的密码会被拒绝
+const PasswordMaxBytes = 72
+
+// 密码策略中可以要求的字符类型
+const (
+	PasswordRequireLetter = "letter" // 至少一个字母
+	PasswordRequireUpper  = "upper"  // 至少一个大写字母
+	PasswordRequireLower  = "lower"  // 至少一个小写字母
+	PasswordRequireDigit  = "digit"  // 至少一个数字
+	PasswordRequireSymbol = "symbol" // 至少一个标点或符号
+)
+
+// passwordClassNames 字符类型在提示信息中的名称
+var passwordClassNames = map[string]string{
+	PasswordRequireLetter: "letter",
+	PasswordRequireUpper:  "uppercase letter",
+	PasswordRequireLower:  "lowercase letter",
+	PasswordRequireDigit:  "digit",
+	PasswordRequireSymbol: "symbol",
+}
+
+// PasswordPolicy 密码策略和哈希参数
+type PasswordPolicy struct {
+	MinLength int      `json:"min_length"` // 最少字符数
+	MaxBytes  int      `json:"max_bytes"`  // 最多字节数，固定为bcrypt的上限
+	Require   []string `json:"require"`    // 必须包含的字符类型
+	HashCost  int      `json:"-"`          // bcrypt代价，修改后用户下次登录时自动按新代价重新加密
+
+	problems []string // 解析环境变量时发现的问题，由Validate报告
+}
+
+// GetPasswordPolicy 获取密码策略
+func GetPasswordPolicy() PasswordPolicy {
+	policy := PasswordPolicy{
+		MinLength: 8,
+		MaxBytes:  PasswordMaxBytes,
+		Require:   splitList(strings.ToLower(getEnv("PASSWORD_REQUIRE", ""))),
+		HashCost:  bcrypt.DefaultCost,
+	}
+
+	if value := getEnv("PASSWORD_MIN_LENGTH", ""); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			policy.MinLength = n
+		} else {
+			policy.problems = append(policy.problems, fmt.Sprintf("PASSWORD_MIN_LENGTH %q is not a number", value))
+		}
+	}
+
+	if value := getEnv("PASSWORD_HASH_COST", ""); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			policy.HashCost = n
+		} else {
+			policy.problems = append(policy.problems, fmt.Sprintf("PASSWORD_HASH_COST %q is not a number", value))
+		}
+	}
+
+	return policy
+}
+
+// Validate 检查密码策略配置，返回的错误列出所有问题
+func (p PasswordPolicy) Validate() error {
+	problems := append([]string(nil), p.problems...)
+
+	if p.MinLength < 1 || p.MinLength > PasswordMaxBytes {
+		problems = append(problems, fmt.Sprintf("PASSWORD_MIN_LENGTH %d is out of range 1-%d", p.MinLength, PasswordMaxBytes))
+	}
+	if p.HashCost < bcrypt.MinCost || p.HashCost > bcrypt.MaxCost {
+		problems = append(problems, fmt.Sprintf("PASSWORD_HASH_COST %d is out of range %d-%d", p.HashCost, bcrypt.MinCost, bcrypt.MaxCost))
+	}
+	for _, class := range p.Require {
+		if _, ok := passwordClassNames[class]; !ok {
+			problems = append(problems, fmt.Sprintf("PASSWORD_REQUIRE %q is invalid, use letter, upper, lower, digit or symbol", class))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// Check 检查密码是否符合策略，不符合时返回的错误可以直接展示给用户
+// 密码不能与用户名或邮箱相同
+func (p PasswordPolicy) Check(password string, identities ...string) error {
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("Password must be at least %d characters", p.MinLength)
+	}
+	if len(password) > PasswordMaxBytes {
+		return fmt.Errorf("Password must be at most %d bytes", PasswordMaxBytes)
+	}
+
+	for _, class := range p.Require {
+		if !containsClass(password, class) {
+			return fmt.Errorf("Password must contain at least one %s", passwordClassNames[class])
+		}
+	}
+
+	for _, identity := range identities {
+		if identity != "" && strings.EqualFold(password, identity) {
+			return errors.New("Password must not be the same as your username or email")
+		}
+	}
+	return nil
+}
+
+// containsClass 检查密码是否包含指定类型的字符
+func containsClass(password, class string) bool {
+	for _, r := range password {
+		switch class {
+		case PasswordRequireLetter:
+			if unicode.IsLetter(r) {
+				return true
+			}
+		case PasswordRequireUpper:
+			if unicode.IsUpper(r) {
+				return true
+			}
+		case PasswordRequireLower:
+			if unicode.IsLower(r) {
+				return true
+			}
+		case PasswordRequireDigit:
+			if unicode.IsDigit(r) {
+				return true
+			}
+		case PasswordRequireSymbol:
+			if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+				return true
+			}
+		}
+	}
+	return false
+}
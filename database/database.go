@@ -37,6 +37,12 @@ func InitDB() *gorm.DB {
 	return db
 }
 
+// DropLegacyIndexes 删除表结构调整后不再使用的旧索引，需在AutoMigrate之前调用
+func DropLegacyIndexes(db *gorm.DB) error {
+	// 提醒表由每个用户一条改为多条，旧的user_id唯一索引已替换为普通索引
+	return db.Exec("DROP INDEX IF EXISTS idx_check_in_reminders_user_id").Error
+}
+
 // GetDB 获取数据库实例
 func GetDB() *gorm.DB {
 	return DB
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"checkin-system/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxAPITokensPerUser 每个用户最多可同时持有的有效API令牌数
+const maxAPITokensPerUser = 10
+
+// maxAPITokenDays API令牌的最长有效天数
+const maxAPITokenDays = 365
+
+// APITokenHandler 个人API令牌处理器
+type APITokenHandler struct {
+	db *gorm.DB
+}
+
+// NewAPITokenHandler 创建个人API令牌处理器
+func NewAPITokenHandler(db *gorm.DB) *APITokenHandler {
+	return &APITokenHandler{
+		db: db,
+	}
+}
+
+// APITokenRequest 创建API令牌请求
+type APITokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0表示不过期
+}
+
+// ListAPITokens 获取API令牌列表，包括已撤销和已过期的令牌
+func (h *APITokenHandler) ListAPITokens(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var tokens []models.APIToken
+	if err := h.db.Where("user_id = ?", userID).Order("id DESC").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+		"scopes": models.APIScopes,
+	})
+}
+
+// CreateAPIToken 创建API令牌，令牌明文只在此时返回
+func (h *APITokenHandler) CreateAPIToken(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req APITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := validateAPITokenRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	h.db.Model(&models.APIToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+		Count(&count)
+	if count >= maxAPITokensPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d active API tokens are allowed", maxAPITokensPerUser)})
+		return
+	}
+
+	secret, err := generateAPIToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API token"})
+		return
+	}
+
+	token := models.APIToken{
+		UserID:    userID,
+		Name:      req.Name,
+		TokenHash: models.HashToken(secret),
+		Hint:      secret[:len(models.APITokenPrefix)+6],
+		Scopes:    req.Scopes,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := h.db.Create(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "API token created. Copy it now, it will not be shown again.",
+		"api_token": token,
+		"token":     secret,
+	})
+}
+
+// revokeAPITokens 撤销用户所有未撤销的API令牌，修改或重置密码时在同一事务中调用
+// 否则拿到过账户的人创建的令牌在密码更换后仍然有效
+func revokeAPITokens(tx *gorm.DB, userID uint, now time.Time) error {
+	return tx.Model(&models.APIToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error
+}
+
+// RevokeAPIToken 撤销API令牌，撤销后立即失效，记录保留以便查看
+func (h *APITokenHandler) RevokeAPIToken(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	token, ok := h.findAPIToken(c, userID)
+	if !ok {
+		return
+	}
+
+	result := h.db.Model(&models.APIToken{}).
+		Where("id = ? AND revoked_at IS NULL", token.ID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API token"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "API token is already revoked"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API token revoked successfully",
+	})
+}
+
+// findAPIToken 根据路径参数查找当前用户的API令牌，找不到时直接写入响应
+func (h *APITokenHandler) findAPIToken(c *gin.Context, userID uint) (models.APIToken, bool) {
+	var token models.APIToken
+
+	id, err := parseInt(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API token id"})
+		return token, false
+	}
+
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).First(&token).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API token not found"})
+		return token, false
+	}
+
+	return token, true
+}
+
+// validateAPITokenRequest 校验权限范围和有效期
+func validateAPITokenRequest(req *APITokenRequest) error {
+	if len(req.Scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+
+	for _, scope := range req.Scopes {
+		if !models.IsAPIScope(scope) {
+			return fmt.Errorf("unsupported scope %q", scope)
+		}
+	}
+
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAPITokenDays {
+		return fmt.Errorf("expires_in_days must be between 0 and %d", maxAPITokenDays)
+	}
+	return nil
+}
+
+// generateAPIToken 生成带前缀的随机API令牌
+func generateAPIToken() (string, error) {
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return models.APITokenPrefix + hex.EncodeToString(bytes), nil
+}
@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"checkin-system/models"
+	"checkin-system/services"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -13,13 +15,17 @@ import (
 
 // CheckInHandler 签到处理器
 type CheckInHandler struct {
-	db *gorm.DB
+	db          *gorm.DB
+	linkService *services.CheckInLinkService
+	webhooks    *services.WebhookService
 }
 
 // NewCheckInHandler 创建签到处理器
-func NewCheckInHandler(db *gorm.DB) *CheckInHandler {
+func NewCheckInHandler(db *gorm.DB, linkService *services.CheckInLinkService, webhooks *services.WebhookService) *CheckInHandler {
 	return &CheckInHandler{
-		db: db,
+		db:          db,
+		linkService: linkService,
+		webhooks:    webhooks,
 	}
 }
 
@@ -28,6 +34,12 @@ type CheckInRequest struct {
 	Note string `json:"note"`
 }
 
+// errAlreadyCheckedIn 今天已经签到过
+var errAlreadyCheckedIn = errors.New("already checked in today")
+
+// errLinkAlreadyUsed 一键签到链接已被使用
+var errLinkAlreadyUsed = errors.New("check-in link already used")
+
 // CheckIn 用户签到
 func (h *CheckInHandler) CheckIn(c *gin.Context) {
 	userID := c.GetUint("user_id")
@@ -38,38 +50,174 @@ func (h *CheckInHandler) CheckIn(c *gin.Context) {
 		return
 	}
 
-	// 检查今天是否已经签到
-	var todayCheckIn models.CheckIn
-	//today := time.Now()
-	err := h.db.Where("user_id = ? AND DATE(checkin_at) = CURRENT_DATE", userID).First(&todayCheckIn).Error
-	if err == nil {
+	checkIn, err := h.recordCheckIn(userID, req.Note, nil)
+	if err == errAlreadyCheckedIn {
 		c.JSON(http.StatusConflict, gin.H{"error": "Already checked in today"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check in"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Check in successful",
+		"checkin": checkIn,
+	})
+}
+
+// CheckInLinkPage 一键签到链接落地页
+// 邮件客户端和安全网关会预取链接，因此GET请求只展示确认按钮，由POST完成签到
+func (h *CheckInHandler) CheckInLinkPage(c *gin.Context) {
+	token := c.Query("token")
+
+	if _, err := h.linkService.Parse(token); err != nil {
+		c.HTML(http.StatusBadRequest, "checkin_link.html", gin.H{
+			"title": "一键签到",
+			"error": linkErrorMessage(err),
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "checkin_link.html", gin.H{
+		"title": "一键签到",
+		"token": token,
+	})
+}
+
+// CheckInByLink 通过一键签到链接签到，无需登录
+func (h *CheckInHandler) CheckInByLink(c *gin.Context) {
+	token := c.PostForm("token")
+
+	// 链接只在生成它的那一天（用户时区）有效
+	claims, err := h.linkService.Parse(token)
+	if err == nil && claims.Day != time.Now().In(userLocation(h.db, claims.UserID)).Format("2006-01-02") {
+		err = services.ErrExpiredLinkToken
+	}
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "checkin_link.html", gin.H{
+			"title": "一键签到",
+			"error": linkErrorMessage(err),
+		})
+		return
+	}
+
+	// 使用记录与签到在同一事务中写入，签到失败时链接仍然可以再次使用
+	use := models.CheckInLinkUse{
+		UserID: claims.UserID,
+		Nonce:  claims.Nonce,
+		Day:    claims.Day,
+		UsedAt: time.Now(),
+	}
+	_, err = h.recordCheckIn(claims.UserID, "通过邮件链接签到", &use)
+	if err == errLinkAlreadyUsed {
+		c.HTML(http.StatusConflict, "checkin_link.html", gin.H{
+			"title": "一键签到",
+			"error": "该签到链接已被使用",
+		})
+		return
+	}
+	if err != nil && err != errAlreadyCheckedIn {
+		c.HTML(http.StatusInternalServerError, "checkin_link.html", gin.H{
+			"title": "一键签到",
+			"error": "签到失败，请稍后登录系统重试",
+		})
+		return
+	}
+
+	message := "签到成功，大家知道你还没死了！"
+	if err == errAlreadyCheckedIn {
+		message = "你今天已经签到过了"
+	}
+
+	c.HTML(http.StatusOK, "checkin_link.html", gin.H{
+		"title":   "一键签到",
+		"message": message,
+	})
+}
+
+// recordCheckIn 创建今天的签到记录，同时重置升级进度、更新下次提醒时间并触发checkin.created事件
+// 通过一键签到链接签到时传入linkUse，使用记录与签到记录在同一事务中写入
+func (h *CheckInHandler) recordCheckIn(userID uint, note string, linkUse *models.CheckInLinkUse) (models.CheckIn, error) {
+	loc := userLocation(h.db, userID)
+
+	tx := h.db.Begin()
+
+	// Nonce唯一索引保证链接只能使用一次
+	if linkUse != nil {
+		if err := tx.Create(linkUse).Error; err != nil {
+			tx.Rollback()
+			return models.CheckIn{}, errLinkAlreadyUsed
+		}
+	}
+
+	// 检查今天（用户时区）是否已经签到，已签到时仍然提交链接使用记录
+	var todayCheckIn models.CheckIn
+	dayStart, dayEnd := models.DayBounds(time.Now(), loc)
+	err := tx.Where("user_id = ? AND checkin_at >= ? AND checkin_at < ?", userID, dayStart, dayEnd).First(&todayCheckIn).Error
+	if err == nil {
+		if err := tx.Commit().Error; err != nil {
+			return todayCheckIn, err
+		}
+		return todayCheckIn, errAlreadyCheckedIn
+	}
 
 	// 创建签到记录
 	checkIn := models.CheckIn{
 		UserID:    userID,
 		CheckInAt: time.Now(),
-		Note:      req.Note,
+		Note:      note,
 	}
 
-	if err := h.db.Create(&checkIn).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check in"})
-		return
+	if err := tx.Create(&checkIn).Error; err != nil {
+		tx.Rollback()
+		return checkIn, err
 	}
 
-	// 更新下次提醒时间
-	var reminder models.CheckInReminder
-	if err := h.db.Where("user_id = ?", userID).First(&reminder).Error; err == nil {
-		reminder.NextReminder = reminder.CalculateNextReminder(checkIn.CheckInAt)
-		h.db.Save(&reminder)
+	if err := tx.Commit().Error; err != nil {
+		return checkIn, err
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "Check in successful",
-		"checkin": checkIn,
+	// 重置升级策略进度
+	resetEscalation(h.db, userID, checkIn.CheckInAt)
+
+	// 今天已经签到，所有已启用提醒推迟到下一个签到周期
+	var reminders []models.CheckInReminder
+	h.db.Where("user_id = ? AND is_enabled = ?", userID, true).Find(&reminders)
+	for _, reminder := range reminders {
+		reminder.NextReminder = reminder.CalculateNextReminder(checkIn.CheckInAt, loc)
+		h.db.Model(&reminder).Update("next_reminder", reminder.NextReminder)
+	}
+
+	h.webhooks.Emit(userID, models.WebhookEventCheckInCreated, map[string]interface{}{
+		"checkin_id": checkIn.ID,
+		"checkin_at": checkIn.CheckInAt,
+		"note":       checkIn.Note,
 	})
+
+	return checkIn, nil
+}
+
+// userPauses 获取用户的所有暂停时段
+func (h *CheckInHandler) userPauses(userID uint) []models.CheckInPause {
+	var pauses []models.CheckInPause
+	h.db.Where("user_id = ?", userID).Order("start_at ASC").Find(&pauses)
+	return pauses
+}
+
+// userLocation 获取用户所在时区
+func userLocation(db *gorm.DB, userID uint) *time.Location {
+	var timezone string
+	db.Model(&models.User{}).Where("id = ?", userID).Pluck("timezone", &timezone)
+	return models.LoadLocation(timezone)
+}
+
+// linkErrorMessage 将链接令牌错误转换为页面提示
+func linkErrorMessage(err error) string {
+	if err == services.ErrExpiredLinkToken {
+		return "该签到链接已过期，请登录系统签到"
+	}
+	return "无效的签到链接"
 }
 
 // GetCheckInHistory 获取签到历史
@@ -109,8 +257,12 @@ func (h *CheckInHandler) GetCheckInHistory(c *gin.Context) {
 		return
 	}
 
-	// 计算连续签到天数
-	consecutiveDays := models.GetConsecutiveDays(checkIns)
+	// 计算连续签到天数，分页数据可能不完整，需要单独加载
+	consecutiveDays, err := services.ConsecutiveDays(h.db, userID, h.userPauses(userID), userLocation(h.db, userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch check-in history"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"checkins":          checkIns,
@@ -125,25 +277,34 @@ func (h *CheckInHandler) GetCheckInHistory(c *gin.Context) {
 func (h *CheckInHandler) GetCheckInStatus(c *gin.Context) {
 	userID := c.GetUint("user_id")
 
-	// 检查今天是否已签到
+	loc := userLocation(h.db, userID)
+	now := time.Now().In(loc)
+
+	// 检查今天（用户时区）是否已签到
 	var todayCheckIn models.CheckIn
-	err := h.db.Where("user_id = ? AND DATE(checkin_at) = CURRENT_DATE", userID).First(&todayCheckIn).Error
+	dayStart, dayEnd := models.DayBounds(now, loc)
+	err := h.db.Where("user_id = ? AND checkin_at >= ? AND checkin_at < ?", userID, dayStart, dayEnd).First(&todayCheckIn).Error
 	
 	todayChecked := err == nil
 
 	// 获取最近7天的签到记录
-	sevenDaysAgo := time.Now().AddDate(0, 0, -7)
+	sevenDaysAgo := dayStart.AddDate(0, 0, -7)
 	var recentCheckIns []models.CheckIn
 	
 	h.db.Where("user_id = ? AND checkin_at >= ?", userID, sevenDaysAgo).
 		Order("checkin_at DESC").
 		Find(&recentCheckIns)
 
-	// 计算连续签到天数
-	consecutiveDays := models.GetConsecutiveDays(recentCheckIns)
+	// 计算连续签到天数，连续签到可能早于最近7天，需要加载到连续签到开始
+	pauses := h.userPauses(userID)
+	consecutiveDays, err := services.ConsecutiveDays(h.db, userID, pauses, loc)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch check-in status"})
+		return
+	}
 
 	// 获取本月签到次数
-	monthStart := time.Date(time.Now().Year(), time.Now().Month(), 1, 0, 0, 0, 0, time.Now().Location())
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
 	var monthCount int64
 	h.db.Model(&models.CheckIn{}).
 		Where("user_id = ? AND checkin_at >= ?", userID, monthStart).
@@ -154,12 +315,20 @@ func (h *CheckInHandler) GetCheckInStatus(c *gin.Context) {
 		"consecutive_days":  consecutiveDays,
 		"month_count":       monthCount,
 		"recent_checkins":   recentCheckIns,
+		"timezone":          loc.String(),
 	}
 
 	if todayChecked {
 		status["last_checkin"] = todayCheckIn
 	}
 
+	// 暂停状态
+	activePause := models.ActivePause(pauses, now)
+	status["paused"] = activePause != nil
+	if activePause != nil {
+		status["pause"] = activePause
+	}
+
 	c.JSON(http.StatusOK, status)
 }
 
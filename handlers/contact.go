@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"checkin-system/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxContactsPerUser 每个用户最多可添加的紧急联系人数
+const maxContactsPerUser = 10
+
+// ContactHandler 紧急联系人处理器
+type ContactHandler struct {
+	db *gorm.DB
+}
+
+// NewContactHandler 创建紧急联系人处理器
+func NewContactHandler(db *gorm.DB) *ContactHandler {
+	return &ContactHandler{
+		db: db,
+	}
+}
+
+// ContactRequest 创建紧急联系人请求
+type ContactRequest struct {
+	Name         string `json:"name" binding:"required,max=100"`
+	Email        string `json:"email" binding:"required,email"`
+	Relationship string `json:"relationship" binding:"max=50"`
+	IsEnabled    *bool  `json:"is_enabled"`
+}
+
+// UpdateContactRequest 更新紧急联系人请求
+type UpdateContactRequest struct {
+	Name         *string `json:"name" binding:"omitempty,max=100"`
+	Email        *string `json:"email" binding:"omitempty,email"`
+	Relationship *string `json:"relationship" binding:"omitempty,max=50"`
+	IsEnabled    *bool   `json:"is_enabled"`
+}
+
+// ListContacts 获取紧急联系人列表
+func (h *ContactHandler) ListContacts(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var contacts []models.EmergencyContact
+	if err := h.db.Where("user_id = ?", userID).Order("id ASC").Find(&contacts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch contacts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"contacts": contacts,
+	})
+}
+
+// CreateContact 添加紧急联系人
+func (h *ContactHandler) CreateContact(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req ContactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 每个升级阶段都会向所有联系人发送邮件，限制数量并要求先验证邮箱
+	if !requireVerifiedEmail(c, h.db, userID, "Please verify your email before adding emergency contacts") {
+		return
+	}
+
+	var count int64
+	h.db.Model(&models.EmergencyContact{}).Where("user_id = ?", userID).Count(&count)
+	if count >= maxContactsPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d emergency contacts are allowed", maxContactsPerUser)})
+		return
+	}
+
+	contact := models.EmergencyContact{
+		UserID:       userID,
+		Name:         req.Name,
+		Email:        req.Email,
+		Relationship: req.Relationship,
+		IsEnabled:    true,
+	}
+	if req.IsEnabled != nil {
+		contact.IsEnabled = *req.IsEnabled
+	}
+
+	if err := h.db.Create(&contact).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create contact"})
+		return
+	}
+
+	// 创建时布尔零值会被替换为字段默认值，需要单独更新
+	if req.IsEnabled != nil && !*req.IsEnabled {
+		contact.IsEnabled = false
+		h.db.Model(&contact).Update("is_enabled", false)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Contact created successfully",
+		"contact": contact,
+	})
+}
+
+// UpdateContact 更新紧急联系人
+func (h *ContactHandler) UpdateContact(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	contact, ok := h.findContact(c, userID)
+	if !ok {
+		return
+	}
+
+	var req UpdateContactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name != nil {
+		contact.Name = *req.Name
+	}
+
+	if req.Email != nil && *req.Email != contact.Email {
+		if !requireVerifiedEmail(c, h.db, userID, "Please verify your email before changing emergency contacts") {
+			return
+		}
+		contact.Email = *req.Email
+	}
+
+	if req.Relationship != nil {
+		contact.Relationship = *req.Relationship
+	}
+
+	if req.IsEnabled != nil {
+		contact.IsEnabled = *req.IsEnabled
+	}
+
+	if err := h.db.Save(&contact).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update contact"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Contact updated successfully",
+		"contact": contact,
+	})
+}
+
+// DeleteContact 删除紧急联系人
+func (h *ContactHandler) DeleteContact(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	contact, ok := h.findContact(c, userID)
+	if !ok {
+		return
+	}
+
+	tx := h.db.Begin()
+
+	if err := tx.Where("contact_id = ?", contact.ID).Delete(&models.ContactNotification{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete contact notifications"})
+		return
+	}
+
+	if err := tx.Delete(&contact).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete contact"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete contact"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Contact deleted successfully",
+	})
+}
+
+// findContact 根据路径参数查找当前用户的紧急联系人，找不到时直接写入响应
+func (h *ContactHandler) findContact(c *gin.Context, userID uint) (models.EmergencyContact, bool) {
+	var contact models.EmergencyContact
+
+	id, err := parseInt(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contact id"})
+		return contact, false
+	}
+
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).First(&contact).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contact not found"})
+		return contact, false
+	}
+
+	return contact, true
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+
+	"checkin-system/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DevHandler 开发环境辅助页面处理器，只在APP_ENV=development时注册路由
+type DevHandler struct {
+	emailService *services.EmailService
+}
+
+// NewDevHandler 创建开发环境辅助页面处理器
+func NewDevHandler(emailService *services.EmailService) *DevHandler {
+	return &DevHandler{
+		emailService: emailService,
+	}
+}
+
+// Mailbox 列出file或memory方式捕获的邮件，format=json时返回JSON
+func (h *DevHandler) Mailbox(c *gin.Context) {
+	mailbox, ok := h.emailService.Mailbox()
+	if !ok {
+		c.HTML(http.StatusOK, "mailbox.html", gin.H{
+			"title": "开发邮箱",
+			"error": "当前邮件发送方式不保留邮件，请设置 MAIL_TRANSPORT=memory 或 file",
+		})
+		return
+	}
+
+	messages, err := mailbox.Messages()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read mailbox: " + err.Error()})
+		return
+	}
+
+	if c.Query("format") == "json" {
+		c.JSON(http.StatusOK, gin.H{"messages": messages})
+		return
+	}
+
+	c.HTML(http.StatusOK, "mailbox.html", gin.H{
+		"title":    "开发邮箱",
+		"messages": messages,
+	})
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"net/http"
+
+	"checkin-system/models"
+	"checkin-system/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// EmailHandler 发件箱处理器，用于查看邮件发送状态和重发
+type EmailHandler struct {
+	db           *gorm.DB
+	emailService *services.EmailService
+}
+
+// NewEmailHandler 创建发件箱处理器
+func NewEmailHandler(db *gorm.DB, emailService *services.EmailService) *EmailHandler {
+	return &EmailHandler{
+		db:           db,
+		emailService: emailService,
+	}
+}
+
+// ListEmails 获取当前用户的邮件发送记录，可按状态和事件过滤
+func (h *EmailHandler) ListEmails(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := parseInt(l); err == nil && parsed > 0 && parsed <= 200 {
+			limit = parsed
+		}
+	}
+
+	query := h.db.Where("user_id = ?", userID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if event := c.Query("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+
+	var emails []models.EmailOutbox
+	if err := query.Omit("body", "html_body").Order("id DESC").Limit(limit).Find(&emails).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch emails"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"emails": emails,
+	})
+}
+
+// GetEmail 获取一封邮件的详情，敏感邮件不返回正文
+func (h *EmailHandler) GetEmail(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	email, ok := h.findEmail(c, userID)
+	if !ok {
+		return
+	}
+
+	if email.Sensitive {
+		email.Body = ""
+		email.HTMLBody = ""
+	}
+
+	c.JSON(http.StatusOK, email)
+}
+
+// ResendEmail 将一封邮件复制为新邮件重新发送
+func (h *EmailHandler) ResendEmail(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	email, ok := h.findEmail(c, userID)
+	if !ok {
+		return
+	}
+
+	if email.Status == models.EmailStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is still waiting to be sent"})
+		return
+	}
+
+	resent, err := h.emailService.Resend(&email)
+	if err == services.ErrEmailNotResendable {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This email can no longer be resent"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resend email"})
+		return
+	}
+
+	if resent.Sensitive {
+		resent.Body = ""
+		resent.HTMLBody = ""
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Email queued for resending",
+		"email":   resent,
+	})
+}
+
+// findEmail 根据路径参数查找当前用户的邮件，找不到时直接写入响应
+func (h *EmailHandler) findEmail(c *gin.Context, userID uint) (models.EmailOutbox, bool) {
+	var email models.EmailOutbox
+
+	id, err := parseInt(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email id"})
+		return email, false
+	}
+
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).First(&email).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Email not found"})
+		return email, false
+	}
+
+	return email, true
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"checkin-system/models"
+	"checkin-system/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxEscalationStages 每个用户最多可配置的升级阶段数
+const maxEscalationStages = 10
+
+// EscalationHandler 升级策略处理器
+type EscalationHandler struct {
+	db           *gorm.DB
+	emailService *services.EmailService
+}
+
+// NewEscalationHandler 创建升级策略处理器
+func NewEscalationHandler(db *gorm.DB, emailService *services.EmailService) *EscalationHandler {
+	return &EscalationHandler{
+		db:           db,
+		emailService: emailService,
+	}
+}
+
+// EscalationStageRequest 升级阶段配置
+type EscalationStageRequest struct {
+	Name       string `json:"name" binding:"max=50"`
+	AfterHours int    `json:"after_hours" binding:"required,min=1"`
+	Channel    string `json:"channel" binding:"required"`
+	Template   string `json:"template" binding:"required"`
+}
+
+// UpdateEscalationRequest 更新升级策略请求，阶段按AfterHours升序排列
+type UpdateEscalationRequest struct {
+	Stages []EscalationStageRequest `json:"stages" binding:"dive"`
+}
+
+// GetEscalation 获取升级策略及当前进度
+func (h *EscalationHandler) GetEscalation(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var stages []models.EscalationStage
+	if err := h.db.Where("user_id = ?", userID).Order("position ASC").Find(&stages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch escalation policy"})
+		return
+	}
+
+	isDefault := len(stages) == 0
+	if isDefault {
+		stages = models.DefaultEscalationStages(userID)
+	}
+
+	response := gin.H{
+		"stages":     stages,
+		"is_default": isDefault,
+	}
+
+	var state models.EscalationState
+	if err := h.db.Where("user_id = ?", userID).First(&state).Error; err == nil {
+		response["state"] = state
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateEscalation 替换升级策略，传入空列表时恢复默认策略
+func (h *EscalationHandler) UpdateEscalation(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req UpdateEscalationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Stages) > maxEscalationStages {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d stages are allowed", maxEscalationStages)})
+		return
+	}
+
+	stages := make([]models.EscalationStage, 0, len(req.Stages))
+	for i, stage := range req.Stages {
+		if i > 0 && stage.AfterHours <= req.Stages[i-1].AfterHours {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Stages must be ordered by strictly increasing after_hours"})
+			return
+		}
+
+		if !models.IsValidEscalationChannel(stage.Channel) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported channel %q", stage.Channel)})
+			return
+		}
+
+		if !h.emailService.HasTemplate(stage.Template) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown template %q", stage.Template)})
+			return
+		}
+
+		if stage.Channel == models.EscalationChannelWebhook && !h.hasWebhookChannel(userID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Webhook stages require an enabled webhook channel subscribed to %s", models.NotificationEventMissedWarning)})
+			return
+		}
+
+		stages = append(stages, models.EscalationStage{
+			UserID:     userID,
+			Position:   i + 1,
+			Name:       stage.Name,
+			AfterHours: stage.AfterHours,
+			Channel:    stage.Channel,
+			Template:   stage.Template,
+		})
+	}
+
+	tx := h.db.Begin()
+
+	if err := tx.Where("user_id = ?", userID).Delete(&models.EscalationStage{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update escalation policy"})
+		return
+	}
+
+	if len(stages) > 0 {
+		if err := tx.Create(&stages).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update escalation policy"})
+			return
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update escalation policy"})
+		return
+	}
+
+	isDefault := len(stages) == 0
+	if isDefault {
+		stages = models.DefaultEscalationStages(userID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Escalation policy updated successfully",
+		"stages":     stages,
+		"is_default": isDefault,
+	})
+}
+
+// hasWebhookChannel 检查用户是否有已启用且订阅了失联提醒的webhook渠道，没有时webhook阶段必然失败
+func (h *EscalationHandler) hasWebhookChannel(userID uint) bool {
+	var channels []models.NotificationChannel
+	if err := h.db.Where("user_id = ? AND type = ? AND is_enabled = ?", userID, models.NotificationChannelWebhook, true).
+		Find(&channels).Error; err != nil {
+		return false
+	}
+	for _, channel := range channels {
+		if channel.Accepts(models.NotificationEventMissedWarning) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetEscalationHistory 获取升级历史
+func (h *EscalationHandler) GetEscalationHistory(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := parseInt(l); err == nil && parsed > 0 && parsed <= 200 {
+			limit = parsed
+		}
+	}
+
+	var events []models.EscalationEvent
+	if err := h.db.Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch escalation history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+	})
+}
+
+// resetEscalation 用户签到后重置升级进度，已触发过阶段时记录一条重置历史
+func resetEscalation(db *gorm.DB, userID uint, checkInAt time.Time) {
+	var state models.EscalationState
+	if err := db.Where("user_id = ?", userID).First(&state).Error; err != nil {
+		return
+	}
+
+	if state.LastPosition > 0 {
+		db.Create(&models.EscalationEvent{
+			UserID:       userID,
+			Event:        models.EscalationEventReset,
+			Position:     state.LastPosition,
+			SilenceSince: state.SilenceSince,
+			Detail:       "checked in at " + checkInAt.Format(time.RFC3339),
+		})
+	}
+
+	state.SilenceSince = checkInAt
+	state.LastPosition = 0
+	db.Save(&state)
+}
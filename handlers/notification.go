@@ -0,0 +1,541 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"checkin-system/models"
+	"checkin-system/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxChannelsPerUser 每个用户最多可配置的通知渠道数
+const maxChannelsPerUser = 10
+
+// 测试通知和渠道确认邮件的频率限制，防止被用来向任意地址批量发信或探测网络
+const (
+	channelTestLimit  = 5         // 每个用户在channelTestWindow内最多发送的测试通知和确认邮件数
+	channelTestWindow = time.Hour // 统计窗口
+)
+
+// channelVerificationTTL 邮件渠道确认链接的有效期
+const channelVerificationTTL = 24 * time.Hour
+
+// NotificationHandler 通知渠道处理器
+type NotificationHandler struct {
+	db       *gorm.DB
+	notifier *services.NotificationRouter
+	baseURL  string // 对外访问地址，用于生成确认链接
+
+	testMu   sync.Mutex
+	testSent map[uint][]time.Time // 每个用户最近发送测试通知的时间
+}
+
+// NewNotificationHandler 创建通知渠道处理器
+func NewNotificationHandler(db *gorm.DB, notifier *services.NotificationRouter, baseURL string) *NotificationHandler {
+	return &NotificationHandler{
+		db:       db,
+		notifier: notifier,
+		baseURL:  baseURL,
+		testSent: make(map[uint][]time.Time),
+	}
+}
+
+// ChannelRequest 创建通知渠道请求
+type ChannelRequest struct {
+	Name      string   `json:"name" binding:"max=50"`
+	Type      string   `json:"type" binding:"required"`
+	Target    string   `json:"target" binding:"max=500"`
+	Events    []string `json:"events"`
+	IsEnabled *bool    `json:"is_enabled"`
+}
+
+// UpdateChannelRequest 更新通知渠道请求，渠道类型创建后不可修改
+type UpdateChannelRequest struct {
+	Name         *string   `json:"name" binding:"omitempty,max=50"`
+	Target       *string   `json:"target" binding:"omitempty,max=500"`
+	Events       *[]string `json:"events"`
+	IsEnabled    *bool     `json:"is_enabled"`
+	RotateSecret bool      `json:"rotate_secret"` // 生成新的webhook签名密钥，旧密钥立即失效
+}
+
+// ListChannels 获取通知渠道列表
+func (h *NotificationHandler) ListChannels(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var channels []models.NotificationChannel
+	if err := h.db.Where("user_id = ?", userID).Order("id ASC").Find(&channels).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification channels"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"channels": channels,
+		"events":   models.UserNotificationEvents,
+	})
+}
+
+// CreateChannel 添加通知渠道
+func (h *NotificationHandler) CreateChannel(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req ChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	h.db.Model(&models.NotificationChannel{}).Where("user_id = ?", userID).Count(&count)
+	if count >= maxChannelsPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d notification channels are allowed", maxChannelsPerUser)})
+		return
+	}
+
+	channel := models.NotificationChannel{
+		UserID:    userID,
+		Name:      req.Name,
+		Type:      req.Type,
+		Target:    req.Target,
+		Events:    req.Events,
+		IsEnabled: true,
+	}
+	if req.IsEnabled != nil {
+		channel.IsEnabled = *req.IsEnabled
+	}
+
+	if err := validateChannel(&channel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	needsConfirmation, err := resetTargetVerification(&channel, &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate verification token"})
+		return
+	}
+	if needsConfirmation && !h.allowTest(userID, time.Now()) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("At most %d test notifications and confirmation emails per hour are allowed", channelTestLimit)})
+		return
+	}
+
+	response := gin.H{
+		"message": "Notification channel created successfully",
+	}
+
+	// webhook渠道的请求带签名，密钥只在此时返回
+	if channel.Type == models.NotificationChannelWebhook {
+		secret, err := services.GenerateWebhookSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate webhook secret"})
+			return
+		}
+		channel.Secret = secret
+		response["secret"] = secret
+	}
+
+	if err := h.db.Create(&channel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create notification channel"})
+		return
+	}
+
+	// 创建时布尔零值会被替换为字段默认值，需要单独更新
+	if req.IsEnabled != nil && !*req.IsEnabled {
+		channel.IsEnabled = false
+		h.db.Model(&channel).Update("is_enabled", false)
+	}
+
+	if needsConfirmation {
+		h.sendTargetVerification(&channel, &user, response)
+	}
+
+	response["channel"] = channel
+	c.JSON(http.StatusCreated, response)
+}
+
+// UpdateChannel 更新通知渠道
+func (h *NotificationHandler) UpdateChannel(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	channel, ok := h.findChannel(c, userID)
+	if !ok {
+		return
+	}
+
+	var req UpdateChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name != nil {
+		channel.Name = *req.Name
+	}
+
+	targetChanged := req.Target != nil && *req.Target != channel.Target
+	if req.Target != nil {
+		channel.Target = *req.Target
+	}
+
+	if req.Events != nil {
+		channel.Events = *req.Events
+	}
+
+	if req.IsEnabled != nil {
+		channel.IsEnabled = *req.IsEnabled
+	}
+
+	if err := validateChannel(&channel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 地址变化后需要重新确认
+	var user models.User
+	needsConfirmation := false
+	if targetChanged {
+		if err := h.db.First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
+
+		var err error
+		needsConfirmation, err = resetTargetVerification(&channel, &user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate verification token"})
+			return
+		}
+		if needsConfirmation && !h.allowTest(userID, time.Now()) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("At most %d test notifications and confirmation emails per hour are allowed", channelTestLimit)})
+			return
+		}
+	}
+
+	response := gin.H{
+		"message": "Notification channel updated successfully",
+	}
+
+	if req.RotateSecret {
+		if channel.Type != models.NotificationChannelWebhook {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only webhook channels have a signing secret"})
+			return
+		}
+		secret, err := services.GenerateWebhookSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate webhook secret"})
+			return
+		}
+		channel.Secret = secret
+		response["secret"] = secret
+	}
+
+	if err := h.db.Save(&channel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification channel"})
+		return
+	}
+
+	if needsConfirmation {
+		h.sendTargetVerification(&channel, &user, response)
+	}
+
+	response["channel"] = channel
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteChannel 删除通知渠道及其webhook投递记录
+func (h *NotificationHandler) DeleteChannel(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	channel, ok := h.findChannel(c, userID)
+	if !ok {
+		return
+	}
+
+	tx := h.db.Begin()
+
+	if err := tx.Where("channel_id = ?", channel.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook deliveries"})
+		return
+	}
+
+	if err := tx.Delete(&channel).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete notification channel"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete notification channel"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Notification channel deleted successfully",
+	})
+}
+
+// TestChannel 通过指定渠道发送一条测试通知
+func (h *NotificationHandler) TestChannel(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	channel, ok := h.findChannel(c, userID)
+	if !ok {
+		return
+	}
+
+	if channel.NeedsVerification() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The recipient has not confirmed this email channel yet"})
+		return
+	}
+
+	if !h.allowTest(userID, time.Now()) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("At most %d test notifications and confirmation emails per hour are allowed", channelTestLimit)})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	// webhook渠道的测试通知与正常通知一样异步投递，结果见投递记录
+	err := h.notifier.Dispatch(&services.Notification{
+		Event:    models.NotificationEventTest,
+		User:     &user,
+		Template: "test_email",
+		Data: map[string]interface{}{
+			"Username": user.Username,
+		},
+		ChannelID: channel.ID,
+	})
+	if err != nil {
+		// 不返回具体错误，避免暴露目标地址的网络状况
+		log.Printf("Error sending test notification to channel %d of user %d: %v", channel.ID, userID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send test notification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Test notification sent",
+	})
+}
+
+// ResendVerification 重新向邮件渠道的地址发送确认邮件
+func (h *NotificationHandler) ResendVerification(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	channel, ok := h.findChannel(c, userID)
+	if !ok {
+		return
+	}
+
+	if !channel.NeedsVerification() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This channel does not need confirmation"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	if !h.allowTest(userID, time.Now()) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("At most %d test notifications and confirmation emails per hour are allowed", channelTestLimit)})
+		return
+	}
+
+	if _, err := resetTargetVerification(&channel, &user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate verification token"})
+		return
+	}
+	if err := h.db.Save(&channel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification channel"})
+		return
+	}
+
+	response := gin.H{
+		"message": "Confirmation email sent",
+	}
+	h.sendTargetVerification(&channel, &user, response)
+	c.JSON(http.StatusOK, response)
+}
+
+// VerifyChannel 收件人通过确认邮件中的链接确认邮件渠道，不需要登录
+func (h *NotificationHandler) VerifyChannel(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification token is required"})
+		return
+	}
+
+	var channel models.NotificationChannel
+	if err := h.db.Where("verification_token = ? AND type = ?", token, models.NotificationChannelEmail).First(&channel).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+
+	if time.Now().After(channel.VerificationTokenExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification token has expired"})
+		return
+	}
+
+	// 只在令牌未被替换时确认，避免地址修改后旧链接确认了新地址
+	result := h.db.Model(&models.NotificationChannel{}).
+		Where("id = ? AND verification_token = ?", channel.ID, token).
+		Updates(map[string]interface{}{
+			"target_verified":               true,
+			"verification_token":            "",
+			"verification_token_expires_at": time.Time{},
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm email channel"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email address confirmed. It will now receive check-in notifications.",
+	})
+}
+
+// sendTargetVerification 向邮件渠道的地址发送确认邮件，结果写入response
+func (h *NotificationHandler) sendTargetVerification(channel *models.NotificationChannel, user *models.User, response gin.H) {
+	err := h.notifier.Dispatch(&services.Notification{
+		Event:    models.NotificationEventChannelVerification,
+		User:     user,
+		Template: "channel_verification",
+		Data: map[string]interface{}{
+			"Username":        user.Username,
+			"Email":           user.Email,
+			"VerificationURL": h.baseURL + "/api/channels/verify?token=" + url.QueryEscape(channel.VerificationToken),
+		},
+		Channel: models.NotificationChannelEmail,
+		Target:  channel.Target,
+	})
+	if err != nil {
+		log.Printf("Error queueing confirmation email for channel %d of user %d: %v", channel.ID, user.ID, err)
+		response["warning"] = "Failed to send the confirmation email, please try again later"
+		return
+	}
+	response["verification"] = "A confirmation email has been sent to " + channel.Target + ", the channel receives notifications after the recipient confirms it"
+}
+
+// ListChannelDeliveries 获取webhook通知渠道的投递记录
+func (h *NotificationHandler) ListChannelDeliveries(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	channel, ok := h.findChannel(c, userID)
+	if !ok {
+		return
+	}
+
+	listWebhookDeliveries(c, h.db.Where("channel_id = ?", channel.ID))
+}
+
+// allowTest 检查用户是否还可以发送测试通知，允许时记录本次发送
+func (h *NotificationHandler) allowTest(userID uint, now time.Time) bool {
+	h.testMu.Lock()
+	defer h.testMu.Unlock()
+
+	recent := h.testSent[userID][:0]
+	for _, sentAt := range h.testSent[userID] {
+		if now.Sub(sentAt) < channelTestWindow {
+			recent = append(recent, sentAt)
+		}
+	}
+	if len(recent) >= channelTestLimit {
+		h.testSent[userID] = recent
+		return false
+	}
+	h.testSent[userID] = append(recent, now)
+	return true
+}
+
+// findChannel 根据路径参数查找当前用户的通知渠道，找不到时直接写入响应
+func (h *NotificationHandler) findChannel(c *gin.Context, userID uint) (models.NotificationChannel, bool) {
+	var channel models.NotificationChannel
+
+	id, err := parseInt(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel id"})
+		return channel, false
+	}
+
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).First(&channel).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification channel not found"})
+		return channel, false
+	}
+
+	return channel, true
+}
+
+// resetTargetVerification 重置邮件渠道地址的确认状态
+// 地址为已验证的账户邮箱时直接视为已确认，其他地址生成新的确认令牌，返回true表示需要发送确认邮件
+func resetTargetVerification(channel *models.NotificationChannel, user *models.User) (bool, error) {
+	channel.TargetVerified = false
+	channel.VerificationToken = ""
+	channel.VerificationTokenExpiresAt = time.Time{}
+
+	if channel.Type != models.NotificationChannelEmail || channel.Target == "" {
+		return false, nil
+	}
+
+	if address, err := mail.ParseAddress(channel.Target); err == nil && user.EmailVerified && strings.EqualFold(address.Address, user.Email) {
+		channel.TargetVerified = true
+		return false, nil
+	}
+
+	token, err := generateVerificationToken()
+	if err != nil {
+		return false, err
+	}
+	channel.VerificationToken = token
+	channel.VerificationTokenExpiresAt = time.Now().Add(channelVerificationTTL)
+	return true, nil
+}
+
+// validateChannel 校验渠道类型、目标地址和订阅事件
+func validateChannel(channel *models.NotificationChannel) error {
+	switch channel.Type {
+	case models.NotificationChannelEmail:
+		// 邮件渠道的目标为空时使用账户邮箱
+		if channel.Target != "" {
+			if _, err := mail.ParseAddress(channel.Target); err != nil {
+				return fmt.Errorf("invalid email address %q", channel.Target)
+			}
+		}
+	case models.NotificationChannelWebhook:
+		if err := services.CheckPublicURL(channel.Target); err != nil {
+			return fmt.Errorf("webhook target %v", err)
+		}
+	default:
+		return fmt.Errorf("unsupported channel type %q", channel.Type)
+	}
+
+	for _, event := range channel.Events {
+		if !models.IsUserNotificationEvent(event) {
+			return fmt.Errorf("unsupported event %q", event)
+		}
+	}
+	return nil
+}
@@ -27,6 +27,14 @@ func RegisterPageHandler(c *gin.Context) {
 	})
 }
 
+// ResetPasswordPageHandler 找回密码页面处理器，带token时显示设置新密码表单，否则显示申请找回表单
+func ResetPasswordPageHandler(c *gin.Context) {
+	c.HTML(http.StatusOK, "reset_password.html", gin.H{
+		"title": "找回密码",
+		"token": c.Query("token"),
+	})
+}
+
 // DashboardHandler 仪表板页面处理器
 func DashboardHandler(c *gin.Context) {
 	userID := c.GetUint("user_id")
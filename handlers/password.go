@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"checkin-system/middleware"
+	"checkin-system/models"
+	"checkin-system/services"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 找回密码令牌参数
+const (
+	passwordResetTTL      = time.Hour   // 令牌有效期
+	passwordResetInterval = time.Minute // 同一用户两次申请之间的最短间隔，防止被利用来轰炸邮箱
+)
+
+// forgotPasswordMessage 无论邮箱是否存在都返回相同的提示，避免泄露已注册的邮箱
+const forgotPasswordMessage = "If the email is registered, a password reset link has been sent. Please check your inbox and spam folder."
+
+// ForgotPasswordRequest 申请找回密码请求
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest 重置密码请求
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ChangePasswordRequest 修改密码请求
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// GetPasswordPolicy 获取密码策略，供注册和修改密码页面提示
+func (h *UserHandler) GetPasswordPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"policy": h.passwords})
+}
+
+// ChangePassword 修改密码，需要验证当前密码
+// 其他设备上的会话和所有API令牌随之失效，当前会话更新为新的会话版本后继续有效
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if !user.CheckPassword(req.CurrentPassword) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New password must be different from the current password"})
+		return
+	}
+	if err := h.passwords.Check(req.NewPassword, user.Username, user.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := user.SetPassword(req.NewPassword, h.passwords.HashCost); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	tx := h.db.Begin()
+
+	if err := tx.Model(&user).Updates(map[string]interface{}{
+		"password":        user.Password,
+		"session_version": gorm.Expr("session_version + 1"),
+	}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	// 修改密码后，之前申请的找回密码链接不再有效
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	if err := revokeAPITokens(tx, user.ID, time.Now()); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	user.SessionVersion++
+	middleware.SetSession(c, user.ID, user.Username, user.SessionVersion)
+
+	response := gin.H{
+		"message": "Password changed successfully. Other sessions have been signed out and API tokens have been revoked.",
+	}
+
+	// 使用JWT登录的客户端原有令牌已随会话版本失效，换发新的令牌
+	if _, ok := middleware.JWTClaims(c); ok && h.jwt != nil {
+		tokens, err := h.jwt.IssueTokens(&user)
+		if err != nil {
+			log.Printf("Error issuing tokens for user %d: %v", user.ID, err)
+		} else {
+			response["tokens"] = tokens
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ForgotPassword 申请找回密码，向账户邮箱发送重置链接
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := h.db.Where("email = ?", req.Email).First(&user).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			log.Printf("Error looking up user for password reset: %v", err)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
+		return
+	}
+
+	if err := h.sendPasswordReset(&user); err != nil {
+		log.Printf("Error sending password reset to user %d: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
+}
+
+// sendPasswordReset 生成新的找回密码令牌并发送邮件，之前未使用的令牌随之作废
+// 距上次申请不足passwordResetInterval时不重复发送
+func (h *UserHandler) sendPasswordReset(user *models.User) error {
+	var recent int64
+	if err := h.db.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-passwordResetInterval)).
+		Count(&recent).Error; err != nil {
+		return err
+	}
+	if recent > 0 {
+		return nil
+	}
+
+	token, err := generateVerificationToken()
+	if err != nil {
+		return err
+	}
+
+	tx := h.db.Begin()
+
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	resetToken := models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: models.HashToken(token),
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	}
+	if err := tx.Create(&resetToken).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	// 重置邮件始终发送到账户邮箱
+	return h.notifier.Dispatch(&services.Notification{
+		Event:    models.NotificationEventPasswordReset,
+		User:     user,
+		Template: "password_reset",
+		Data: map[string]interface{}{
+			"Username":  user.Username,
+			"ResetURL":  h.baseURL + "/reset-password?token=" + url.QueryEscape(token),
+			"ExpiresIn": int(passwordResetTTL.Minutes()),
+		},
+		Channel: models.NotificationChannelEmail,
+		Target:  user.Email,
+	})
+}
+
+// ResetPassword 使用邮件中的令牌设置新密码，成功后令牌失效，用户所有已登录的会话和API令牌随之失效
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var resetToken models.PasswordResetToken
+	if err := h.db.Where("token_hash = ? AND used_at IS NULL", models.HashToken(req.Token)).First(&resetToken).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired password reset token"})
+		return
+	}
+	if time.Now().After(resetToken.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired password reset token"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, resetToken.UserID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired password reset token"})
+		return
+	}
+
+	if err := h.passwords.Check(req.Password, user.Username, user.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := user.SetPassword(req.Password, h.passwords.HashCost); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	tx := h.db.Begin()
+
+	// 先认领令牌，并发使用同一个令牌时只有一个请求能成功
+	now := time.Now()
+	result := tx.Model(&models.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", resetToken.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired password reset token"})
+		return
+	}
+
+	// 递增会话版本使所有已登录的会话失效；能收到重置邮件说明邮箱属于用户，同时标记为已验证
+	if err := tx.Model(&user).Updates(map[string]interface{}{
+		"password":        user.Password,
+		"session_version": gorm.Expr("session_version + 1"),
+		"email_verified":  true,
+	}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := revokeAPITokens(tx, user.ID, now); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	// 当前浏览器的session也一并清除，需要使用新密码重新登录
+	middleware.ClearSession(c)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password has been reset. Please login with your new password.",
+	})
+}
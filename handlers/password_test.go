@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"checkin-system/config"
+	"checkin-system/models"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testPassword = "old-Passw0rd!"
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.APIToken{}, &models.PasswordResetToken{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// createTestUser 创建带一个有效API令牌的测试用户，测试结束后删除用户及其令牌
+func createTestUser(t *testing.T, db *gorm.DB) *models.User {
+	t.Helper()
+
+	suffix, _ := generateVerificationToken()
+	suffix = suffix[:12]
+	user := models.User{
+		Username: "password-test-" + suffix,
+		Email:    "password-test-" + suffix + "@example.com",
+	}
+	if err := user.SetPassword(testPassword, 4); err != nil {
+		t.Fatalf("set password: %v", err)
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	token, _ := generateAPIToken()
+	if err := db.Create(&models.APIToken{
+		UserID:    user.ID,
+		Name:      "test",
+		TokenHash: models.HashToken(token),
+		Scopes:    []string{"checkin"},
+	}).Error; err != nil {
+		t.Fatalf("create api token: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Where("user_id = ?", user.ID).Delete(&models.APIToken{})
+		db.Where("user_id = ?", user.ID).Delete(&models.PasswordResetToken{})
+		db.Unscoped().Delete(&user)
+	})
+	return &user
+}
+
+// testRouter 注册带session中间件的路由，userID非零时模拟已登录的用户
+func testRouter(method, path string, userID uint, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(sessions.Sessions("test-session", cookie.NewStore([]byte("test-secret"))))
+	r.Handle(method, path, func(c *gin.Context) {
+		if userID != 0 {
+			c.Set("user_id", userID)
+		}
+		handler(c)
+	})
+	return r
+}
+
+func doJSON(r *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func assertAPITokensRevoked(t *testing.T, db *gorm.DB, userID uint) {
+	t.Helper()
+
+	var active int64
+	if err := db.Model(&models.APIToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&active).Error; err != nil {
+		t.Fatalf("count api tokens: %v", err)
+	}
+	if active != 0 {
+		t.Errorf("%d API tokens still active, want 0", active)
+	}
+}
+
+func TestChangePasswordRevokesAPITokens(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db)
+	h := NewUserHandler(db, nil, "", config.GetPasswordPolicy(), nil, nil)
+
+	r := testRouter(http.MethodPut, "/api/password", user.ID, h.ChangePassword)
+	w := doJSON(r, http.MethodPut, "/api/password", ChangePasswordRequest{
+		CurrentPassword: testPassword,
+		NewPassword:     "new-Passw0rd!",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("ChangePassword status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	assertAPITokensRevoked(t, db, user.ID)
+}
+
+func TestResetPasswordRevokesAPITokens(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db)
+	h := NewUserHandler(db, nil, "", config.GetPasswordPolicy(), nil, nil)
+
+	token, _ := generateVerificationToken()
+	if err := db.Create(&models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: models.HashToken(token),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}).Error; err != nil {
+		t.Fatalf("create reset token: %v", err)
+	}
+
+	r := testRouter(http.MethodPost, "/api/password/reset", 0, h.ResetPassword)
+	w := doJSON(r, http.MethodPost, "/api/password/reset", ResetPasswordRequest{
+		Token:    token,
+		Password: "new-Passw0rd!",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("ResetPassword status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	assertAPITokensRevoked(t, db, user.ID)
+}
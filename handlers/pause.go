@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"checkin-system/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PauseHandler 暂停（休假）模式处理器
+type PauseHandler struct {
+	db *gorm.DB
+}
+
+// NewPauseHandler 创建暂停模式处理器
+func NewPauseHandler(db *gorm.DB) *PauseHandler {
+	return &PauseHandler{
+		db: db,
+	}
+}
+
+// CreatePauseRequest 创建暂停请求，StartAt为空时立即开始
+type CreatePauseRequest struct {
+	StartAt    *time.Time `json:"start_at"`
+	EndAt      time.Time  `json:"end_at" binding:"required"`
+	Reason     string     `json:"reason" binding:"max=200"`
+	AutoResume *bool      `json:"auto_resume"`
+}
+
+// ListPauses 获取暂停列表
+func (h *PauseHandler) ListPauses(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var pauses []models.CheckInPause
+	if err := h.db.Where("user_id = ?", userID).Order("start_at DESC").Find(&pauses).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pauses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pauses": pauses,
+		"active": models.ActivePause(pauses, time.Now()),
+	})
+}
+
+// CreatePause 创建暂停
+func (h *PauseHandler) CreatePause(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req CreatePauseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	startAt := now
+	if req.StartAt != nil && req.StartAt.After(now) {
+		startAt = *req.StartAt
+	}
+
+	if !req.EndAt.After(startAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_at must be after start_at"})
+		return
+	}
+
+	if req.EndAt.Sub(startAt) > models.MaxPauseDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A pause cannot be longer than 90 days"})
+		return
+	}
+
+	// 不允许与已有的暂停重叠
+	var pauses []models.CheckInPause
+	h.db.Where("user_id = ?", userID).Find(&pauses)
+	for _, p := range pauses {
+		if !p.StartAt.Before(req.EndAt) || !p.EndTime().After(startAt) {
+			continue
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "Pause overlaps with an existing pause"})
+		return
+	}
+
+	pause := models.CheckInPause{
+		UserID:     userID,
+		StartAt:    startAt,
+		EndAt:      req.EndAt,
+		Reason:     req.Reason,
+		AutoResume: true,
+	}
+	if req.AutoResume != nil {
+		pause.AutoResume = *req.AutoResume
+	}
+
+	if err := h.db.Create(&pause).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create pause"})
+		return
+	}
+
+	// 创建时布尔零值会被替换为字段默认值，需要单独更新
+	if req.AutoResume != nil && !*req.AutoResume {
+		pause.AutoResume = false
+		h.db.Model(&pause).Update("auto_resume", false)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Pause created successfully",
+		"pause":   pause,
+	})
+}
+
+// ResumePause 立即结束暂停；尚未开始的暂停会被直接删除
+func (h *PauseHandler) ResumePause(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	id, err := parseInt(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pause id"})
+		return
+	}
+
+	var pause models.CheckInPause
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).First(&pause).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pause not found"})
+		return
+	}
+
+	now := time.Now()
+	if pause.StartAt.After(now) {
+		if err := h.db.Delete(&pause).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel pause"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Scheduled pause cancelled",
+		})
+		return
+	}
+
+	// 不自动恢复的暂停结束后提醒仍保持静默，同样可以手动恢复
+	if !pause.MutesRemindersAt(now) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Pause has already ended"})
+		return
+	}
+
+	pause.ResumedAt = &now
+	if err := h.db.Save(&pause).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resume"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Resumed successfully",
+		"pause":   pause,
+	})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
@@ -10,6 +11,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// maxRemindersPerUser 每个用户最多可创建的提醒数
+const maxRemindersPerUser = 10
+
 // ReminderHandler 提醒处理器
 type ReminderHandler struct {
 	db *gorm.DB
@@ -22,21 +26,14 @@ func NewReminderHandler(db *gorm.DB) *ReminderHandler {
 	}
 }
 
-// GetReminder 获取提醒设置
+// GetReminder 获取提醒设置（用户的第一条提醒）
+// 用户没有提醒时返回默认设置但不保存，删除全部提醒后不会被重新创建
 func (h *ReminderHandler) GetReminder(c *gin.Context) {
 	userID := c.GetUint("user_id")
 
 	var reminder models.CheckInReminder
-	if err := h.db.Where("user_id = ?", userID).First(&reminder).Error; err != nil {
-		// 如果没有找到，创建默认设置
-		reminder = models.CheckInReminder{
-			UserID:           userID,
-			IsEnabled:        true,
-			ReminderFrequency: "daily",
-			ReminderInterval: 24,
-			NextReminder:     time.Now().AddDate(0, 0, 1),
-		}
-		h.db.Create(&reminder)
+	if err := h.db.Where("user_id = ?", userID).Order("id ASC").First(&reminder).Error; err != nil {
+		reminder = models.DefaultReminder(userID)
 	}
 
 	c.JSON(http.StatusOK, reminder)
@@ -44,12 +41,18 @@ func (h *ReminderHandler) GetReminder(c *gin.Context) {
 
 // UpdateReminderRequest 更新提醒设置请求
 type UpdateReminderRequest struct {
+	Name              *string `json:"name" binding:"omitempty,max=50"`
+	Channel           *string `json:"channel"`
 	IsEnabled         *bool   `json:"is_enabled"`
 	ReminderFrequency *string `json:"reminder_frequency"`
 	ReminderInterval  *int    `json:"reminder_interval"`
+	ReminderTime      *string `json:"reminder_time"`    // 每日提醒时间，HH:MM
+	CheckInDeadline   *string `json:"checkin_deadline"` // 每日签到截止时间，HH:MM，空字符串表示取消
+	CronExpression    *string `json:"cron_expression"`  // custom频率的cron表达式，多个表达式用分号分隔
+	DigestCadence     *string `json:"digest_cadence"`   // 签到摘要邮件频率：weekly、monthly，空字符串表示关闭，属于用户级设置
 }
 
-// UpdateReminder 更新提醒设置
+// UpdateReminder 更新提醒设置（用户的第一条提醒）
 func (h *ReminderHandler) UpdateReminder(c *gin.Context) {
 	userID := c.GetUint("user_id")
 
@@ -60,19 +63,131 @@ func (h *ReminderHandler) UpdateReminder(c *gin.Context) {
 	}
 
 	var reminder models.CheckInReminder
-	if err := h.db.Where("user_id = ?", userID).First(&reminder).Error; err != nil {
-		// 如果没有找到，创建新的
-		reminder = models.CheckInReminder{
-			UserID: userID,
-		}
+	if err := h.db.Where("user_id = ?", userID).Order("id ASC").First(&reminder).Error; err != nil {
+		// 如果没有找到，在默认设置的基础上创建
+		reminder = models.DefaultReminder(userID)
+	}
+
+	h.applyAndSave(c, &reminder, &req, http.StatusOK, "Reminder settings updated successfully")
+}
+
+// ListReminders 获取用户的所有提醒
+func (h *ReminderHandler) ListReminders(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var reminders []models.CheckInReminder
+	if err := h.db.Where("user_id = ?", userID).Order("id ASC").Find(&reminders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reminders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reminders": reminders,
+	})
+}
+
+// CreateReminder 创建一条新的提醒
+func (h *ReminderHandler) CreateReminder(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req UpdateReminderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	h.db.Model(&models.CheckInReminder{}).Where("user_id = ?", userID).Count(&count)
+	if count >= maxRemindersPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d reminders are allowed", maxRemindersPerUser)})
+		return
 	}
 
+	reminder := models.DefaultReminder(userID)
+	h.applyAndSave(c, &reminder, &req, http.StatusCreated, "Reminder created successfully")
+}
+
+// UpdateReminderByID 更新指定的提醒
+func (h *ReminderHandler) UpdateReminderByID(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	reminder, ok := h.findReminder(c, userID)
+	if !ok {
+		return
+	}
+
+	var req UpdateReminderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.applyAndSave(c, &reminder, &req, http.StatusOK, "Reminder updated successfully")
+}
+
+// DeleteReminder 删除指定的提醒
+func (h *ReminderHandler) DeleteReminder(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	reminder, ok := h.findReminder(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Delete(&reminder).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete reminder"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Reminder deleted successfully",
+	})
+}
+
+// findReminder 根据路径参数查找当前用户的提醒，找不到时直接写入响应
+func (h *ReminderHandler) findReminder(c *gin.Context, userID uint) (models.CheckInReminder, bool) {
+	var reminder models.CheckInReminder
+
+	id, err := parseInt(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reminder id"})
+		return reminder, false
+	}
+
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).First(&reminder).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reminder not found"})
+		return reminder, false
+	}
+
+	return reminder, true
+}
+
+// applyAndSave 将请求应用到提醒上，重新计算下次提醒时间并保存
+func (h *ReminderHandler) applyAndSave(c *gin.Context, reminder *models.CheckInReminder, req *UpdateReminderRequest, status int, message string) {
+	userID := reminder.UserID
+
 	// 更新字段
+	if req.Name != nil {
+		reminder.Name = *req.Name
+	}
+
+	if req.Channel != nil {
+		if !models.IsValidReminderChannel(*req.Channel) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported channel %q", *req.Channel)})
+			return
+		}
+		reminder.Channel = *req.Channel
+	}
+
 	if req.IsEnabled != nil {
 		reminder.IsEnabled = *req.IsEnabled
 	}
 
 	if req.ReminderFrequency != nil {
+		if !models.IsValidReminderFrequency(*req.ReminderFrequency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported reminder_frequency %q, use daily, hourly or custom", *req.ReminderFrequency)})
+			return
+		}
 		reminder.ReminderFrequency = *req.ReminderFrequency
 	}
 
@@ -80,6 +195,58 @@ func (h *ReminderHandler) UpdateReminder(c *gin.Context) {
 		reminder.ReminderInterval = *req.ReminderInterval
 	}
 
+	// 间隔用于hourly频率和未设置表达式的custom频率，小于1小时会导致每轮检查都发送提醒
+	if reminder.ReminderInterval < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reminder_interval must be at least 1 hour"})
+		return
+	}
+
+	if req.ReminderTime != nil {
+		if _, _, err := models.ParseClock(*req.ReminderTime); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reminder_time: " + err.Error()})
+			return
+		}
+		reminder.ReminderTime = *req.ReminderTime
+	}
+
+	if req.CronExpression != nil {
+		reminder.CronExpression = *req.CronExpression
+	}
+
+	// custom频率必须提供有效的cron表达式
+	if reminder.ReminderFrequency == "custom" {
+		if _, err := models.ParseCronExpression(reminder.CronExpression); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+				"hint":  "Use standard 5-field cron syntax (minute hour day-of-month month day-of-week), separate multiple expressions with ';', e.g. \"30 8 * * 1-5; 0 20 * * 1-5\"",
+			})
+			return
+		}
+
+		// 间隔过短的表达式会让每轮检查都发送提醒，要求与reminder_interval相同的最小间隔
+		if err := models.CheckCronSpacing(reminder.CronExpression, time.Now()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if req.CheckInDeadline != nil {
+		if *req.CheckInDeadline != "" {
+			if _, _, err := models.ParseClock(*req.CheckInDeadline); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "checkin_deadline: " + err.Error()})
+				return
+			}
+		}
+		reminder.CheckInDeadline = *req.CheckInDeadline
+	}
+
+	if req.DigestCadence != nil && !models.IsValidDigestCadence(*req.DigestCadence) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported digest_cadence %q, use weekly, monthly or an empty string", *req.DigestCadence)})
+		return
+	}
+
+	loc := userLocation(h.db, userID)
+
 	// 如果启用了提醒，重新计算下次提醒时间
 	if reminder.IsEnabled {
 		var lastCheckIn time.Time
@@ -88,19 +255,45 @@ func (h *ReminderHandler) UpdateReminder(c *gin.Context) {
 			Order("checkin_at DESC").
 			Limit(1).
 			Pluck("checkin_at", &lastCheckIn)
-		
-		reminder.NextReminder = reminder.CalculateNextReminder(lastCheckIn)
+
+		reminder.NextReminder = reminder.CalculateNextReminder(lastCheckIn, loc)
 	} else {
 		reminder.NextReminder = time.Time{}
 	}
 
-	if err := h.db.Save(&reminder).Error; err != nil {
+	isNew := reminder.ID == 0
+	isEnabled := reminder.IsEnabled
+	if err := h.db.Save(reminder).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reminder settings"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":  "Reminder settings updated successfully",
+	// 创建时布尔零值会被替换为字段默认值，需要单独更新
+	if isNew && !isEnabled {
+		reminder.IsEnabled = false
+		h.db.Model(reminder).Update("is_enabled", false)
+	}
+
+	response := gin.H{
+		"message":  message,
 		"reminder": reminder,
-	})
-}
\ No newline at end of file
+	}
+
+	// 摘要频率保存在用户上，对所有提醒生效
+	if req.DigestCadence != nil {
+		if err := h.db.Model(&models.User{}).Where("id = ?", userID).Update("digest_cadence", *req.DigestCadence).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update digest cadence"})
+			return
+		}
+		response["digest_cadence"] = *req.DigestCadence
+	}
+
+	// 返回custom频率接下来的五次提醒时间供用户确认
+	if reminder.ReminderFrequency == "custom" {
+		if preview, err := models.NextCronTimes(reminder.CronExpression, time.Now().In(loc), 5); err == nil {
+			response["preview"] = preview
+		}
+	}
+
+	c.JSON(status, response)
+}
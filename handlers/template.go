@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+
+	"checkin-system/config"
+	"checkin-system/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// templateKeyPattern 模板键只允许小写字母、数字和下划线
+var templateKeyPattern = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+// TemplateHandler 邮件模板管理处理器，仅管理员可用
+type TemplateHandler struct {
+	emailService *services.EmailService
+}
+
+// NewTemplateHandler 创建邮件模板管理处理器
+func NewTemplateHandler(emailService *services.EmailService) *TemplateHandler {
+	return &TemplateHandler{
+		emailService: emailService,
+	}
+}
+
+// PreviewTemplateRequest 预览模板请求
+type PreviewTemplateRequest struct {
+	Locale   string                 `json:"locale"`
+	Data     map[string]interface{} `json:"data"`     // 覆盖示例数据
+	Template *config.EmailTemplate  `json:"template"` // 尚未保存的草稿，为空时预览已保存的模板
+}
+
+// ListTemplates 获取所有邮件模板
+func (h *TemplateHandler) ListTemplates(c *gin.Context) {
+	templates := h.emailService.Templates()
+
+	keys := make([]string, 0, len(templates))
+	for key := range templates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	c.JSON(http.StatusOK, gin.H{
+		"keys":        keys,
+		"templates":   templates,
+		"sample_data": services.TemplateSampleData(),
+	})
+}
+
+// GetTemplate 获取指定邮件模板
+func (h *TemplateHandler) GetTemplate(c *gin.Context) {
+	key := c.Param("key")
+
+	tmpl, exists := h.emailService.Template(key)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key":      key,
+		"template": tmpl,
+	})
+}
+
+// UpdateTemplate 创建或更新邮件模板，校验通过后写入模板文件并重新加载
+func (h *TemplateHandler) UpdateTemplate(c *gin.Context) {
+	key := c.Param("key")
+	if !templateKeyPattern.MatchString(key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template key may only contain lowercase letters, digits and underscores"})
+		return
+	}
+
+	var tmpl config.EmailTemplate
+	if err := c.ShouldBindJSON(&tmpl); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if problems := h.emailService.ValidateTemplate(tmpl); len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Template is invalid",
+			"problems": problems,
+		})
+		return
+	}
+
+	if err := h.emailService.SaveTemplate(key, tmpl); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save template: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Template saved successfully",
+		"key":      key,
+		"template": tmpl,
+	})
+}
+
+// ValidateTemplate 校验模板草稿而不保存
+func (h *TemplateHandler) ValidateTemplate(c *gin.Context) {
+	var tmpl config.EmailTemplate
+	if err := c.ShouldBindJSON(&tmpl); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	problems := h.emailService.ValidateTemplate(tmpl)
+	c.JSON(http.StatusOK, gin.H{
+		"valid":    len(problems) == 0,
+		"problems": problems,
+	})
+}
+
+// PreviewTemplate 使用示例数据渲染模板
+// GET请求预览已保存的模板，format=html时直接返回HTML正文便于在浏览器中查看；POST请求可以提交草稿和自定义数据
+func (h *TemplateHandler) PreviewTemplate(c *gin.Context) {
+	key := c.Param("key")
+
+	req := PreviewTemplateRequest{Locale: c.Query("locale")}
+	if c.Request.Method == http.MethodPost {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	tmpl, exists := h.emailService.Template(key)
+	if req.Template != nil {
+		tmpl = *req.Template
+	} else if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	rendered, err := h.emailService.PreviewTemplate(tmpl, req.Locale, req.Data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to render template: " + err.Error()})
+		return
+	}
+
+	if c.Query("format") == "html" && rendered.HTML != "" {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(rendered.HTML))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"subject": rendered.Subject,
+		"body":    rendered.Body,
+		"html":    rendered.HTML,
+	})
+}
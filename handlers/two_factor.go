@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"checkin-system/models"
+	"checkin-system/services"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TwoFactorHandler 两步验证处理器
+type TwoFactorHandler struct {
+	db        *gorm.DB
+	twoFactor *services.TwoFactorService
+}
+
+// NewTwoFactorHandler 创建两步验证处理器
+func NewTwoFactorHandler(db *gorm.DB, twoFactor *services.TwoFactorService) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		db:        db,
+		twoFactor: twoFactor,
+	}
+}
+
+// TwoFactorCodeRequest 提交动态码的请求
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DisableTwoFactorRequest 关闭两步验证请求，需要同时提供密码和动态码（或恢复码）
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// GetStatus 获取两步验证状态
+func (h *TwoFactorHandler) GetStatus(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	remaining, err := h.twoFactor.RemainingRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  user.TOTPEnabled,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// Setup 生成新的两步验证密钥，返回密钥和otpauth URI，页面据此显示二维码
+func (h *TwoFactorHandler) Setup(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	setup, err := h.twoFactor.Setup(user)
+	if err != nil {
+		h.respondError(c, user, err, "Failed to set up two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Scan the QR code with your authenticator app, then submit a code to enable two-factor authentication",
+		"secret":      setup.Secret,
+		"otpauth_url": setup.OTPAuthURL,
+	})
+}
+
+// Enable 校验动态码并开启两步验证，恢复码只在此时返回一次
+func (h *TwoFactorHandler) Enable(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.twoFactor.Enable(user, req.Code)
+	if err != nil {
+		h.respondError(c, user, err, "Failed to enable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled. Store the recovery codes somewhere safe, they will not be shown again.",
+		"recovery_codes": codes,
+	})
+}
+
+// Disable 关闭两步验证
+func (h *TwoFactorHandler) Disable(c *gin.Context) {
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.CheckPassword(req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return
+	}
+	if err := h.twoFactor.Verify(user, req.Code); err != nil {
+		h.respondError(c, user, err, "Failed to disable two-factor authentication")
+		return
+	}
+
+	if err := h.twoFactor.Disable(user); err != nil {
+		h.respondError(c, user, err, "Failed to disable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，需要提供动态码，之前的恢复码全部作废
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.twoFactor.Verify(user, req.Code); err != nil {
+		h.respondError(c, user, err, "Failed to regenerate recovery codes")
+		return
+	}
+
+	codes, err := h.twoFactor.RegenerateRecoveryCodes(user)
+	if err != nil {
+		h.respondError(c, user, err, "Failed to regenerate recovery codes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Recovery codes regenerated. Previous codes no longer work.",
+		"recovery_codes": codes,
+	})
+}
+
+// currentUser 加载当前登录的用户，不存在时直接返回错误响应
+func (h *TwoFactorHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	var user models.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// respondError 将两步验证服务的错误转换为响应
+func (h *TwoFactorHandler) respondError(c *gin.Context, user *models.User, err error, message string) {
+	switch err {
+	case services.ErrInvalidTwoFactorCode:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+	case services.ErrTwoFactorLocked:
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many invalid codes, please try again later"})
+	case services.ErrTwoFactorEnabled, services.ErrTwoFactorDisabled, services.ErrTwoFactorNotSetUp:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Two-factor error for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
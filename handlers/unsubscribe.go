@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"net/http"
+
+	"checkin-system/models"
+	"checkin-system/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UnsubscribeHandler 退订处理器，邮件中的退订链接无需登录即可使用
+type UnsubscribeHandler struct {
+	db          *gorm.DB
+	unsubscribe *services.UnsubscribeService
+}
+
+// NewUnsubscribeHandler 创建退订处理器
+func NewUnsubscribeHandler(db *gorm.DB, unsubscribe *services.UnsubscribeService) *UnsubscribeHandler {
+	return &UnsubscribeHandler{
+		db:          db,
+		unsubscribe: unsubscribe,
+	}
+}
+
+// unsubscribeEventNames 退订页面中显示的通知类别名称
+var unsubscribeEventNames = map[string]string{
+	models.NotificationEventReminder:       "签到提醒",
+	models.NotificationEventDeadlineMissed: "错过签到截止时间提醒",
+	models.NotificationEventDigest:         "签到摘要",
+}
+
+// UnsubscribePage 退订确认页面
+// GET请求只展示确认按钮，避免邮件安全扫描程序预取链接时误退订
+func (h *UnsubscribeHandler) UnsubscribePage(c *gin.Context) {
+	token := c.Query("token")
+
+	claims, err := h.unsubscribe.Parse(token)
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "unsubscribe.html", gin.H{
+			"title": "退订邮件",
+			"error": "无效的退订链接",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "unsubscribe.html", gin.H{
+		"title":    "退订邮件",
+		"token":    token,
+		"category": h.describe(claims),
+	})
+}
+
+// Unsubscribe 执行退订，无需登录
+// 支持邮件客户端按RFC 8058发起的一键退订（POST正文为List-Unsubscribe=One-Click），此时返回JSON
+func (h *UnsubscribeHandler) Unsubscribe(c *gin.Context) {
+	oneClick := c.PostForm("List-Unsubscribe") == "One-Click"
+	token := c.Query("token")
+	if token == "" {
+		token = c.PostForm("token")
+	}
+
+	claims, err := h.unsubscribe.Parse(token)
+	if err == nil {
+		err = h.apply(claims)
+	}
+	if err != nil {
+		status, message := http.StatusInternalServerError, "退订失败，请稍后重试"
+		if err == services.ErrInvalidUnsubscribeToken {
+			status, message = http.StatusBadRequest, "无效的退订链接"
+		}
+		if oneClick {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.HTML(status, "unsubscribe.html", gin.H{
+			"title": "退订邮件",
+			"error": message,
+		})
+		return
+	}
+
+	if oneClick {
+		c.JSON(http.StatusOK, gin.H{"message": "Unsubscribed successfully"})
+		return
+	}
+	c.HTML(http.StatusOK, "unsubscribe.html", gin.H{
+		"title":   "退订邮件",
+		"message": "已退订" + h.describe(claims) + "，之后不会再收到此类邮件。可以登录系统重新开启。",
+	})
+}
+
+// ListOptOuts 获取当前用户退订的邮件通知类别
+func (h *UnsubscribeHandler) ListOptOuts(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var optOuts []models.EmailOptOut
+	if err := h.db.Where("user_id = ?", userID).Order("id ASC").Find(&optOuts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch opt-outs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"opt_outs": optOuts,
+	})
+}
+
+// DeleteOptOut 重新订阅一个邮件通知类别
+func (h *UnsubscribeHandler) DeleteOptOut(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	id, err := parseInt(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid opt-out id"})
+		return
+	}
+
+	result := h.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.EmailOptOut{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete opt-out"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Opt-out not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Resubscribed successfully",
+	})
+}
+
+// apply 令牌指向提醒时关闭该提醒，摘要直接关闭摘要设置，否则记录对通知类别的退订，重复退订不报错
+func (h *UnsubscribeHandler) apply(claims *services.UnsubscribeClaims) error {
+	if claims.ReminderID != 0 {
+		return h.db.Model(&models.CheckInReminder{}).
+			Where("id = ? AND user_id = ?", claims.ReminderID, claims.UserID).
+			Updates(map[string]interface{}{"is_enabled": false}).Error
+	}
+
+	if claims.Event == models.NotificationEventDigest {
+		return h.db.Model(&models.User{}).Where("id = ?", claims.UserID).
+			Update("digest_cadence", models.DigestCadenceNone).Error
+	}
+
+	if !models.IsUnsubscribableEvent(claims.Event) {
+		return services.ErrInvalidUnsubscribeToken
+	}
+
+	return h.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.EmailOptOut{
+		UserID: claims.UserID,
+		Event:  claims.Event,
+	}).Error
+}
+
+// describe 退订内容的描述
+func (h *UnsubscribeHandler) describe(claims *services.UnsubscribeClaims) string {
+	if claims.ReminderID != 0 {
+		var reminder models.CheckInReminder
+		if err := h.db.Where("id = ? AND user_id = ?", claims.ReminderID, claims.UserID).First(&reminder).Error; err == nil && reminder.Name != "" {
+			return "签到提醒「" + reminder.Name + "」"
+		}
+		return "这条签到提醒"
+	}
+	if name, ok := unsubscribeEventNames[claims.Event]; ok {
+		return name + "邮件"
+	}
+	return "此类邮件"
+}
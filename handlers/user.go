@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"checkin-system/config"
 	"checkin-system/middleware"
 	"checkin-system/models"
 	"checkin-system/services"
 	"crypto/rand"
 	"encoding/hex"
+	"log"
 	"net/http"
+	"net/url"
 	"time"
 
 	//"github.com/gin-contrib/sessions"
@@ -16,15 +19,23 @@ import (
 
 // UserHandler 用户处理器
 type UserHandler struct {
-	db           *gorm.DB
-	emailService *services.EmailService
+	db        *gorm.DB
+	notifier  *services.NotificationRouter
+	baseURL   string // 对外访问地址，用于生成重置密码链接
+	passwords config.PasswordPolicy
+	twoFactor *services.TwoFactorService
+	jwt       *services.JWTService // 未启用JWT模式时为nil
 }
 
-// NewUserHandler 创建用户处理器
-func NewUserHandler(db *gorm.DB, emailService *services.EmailService) *UserHandler {
+// NewUserHandler 创建用户处理器，jwt为nil时登录只使用Session
+func NewUserHandler(db *gorm.DB, notifier *services.NotificationRouter, baseURL string, passwords config.PasswordPolicy, twoFactor *services.TwoFactorService, jwt *services.JWTService) *UserHandler {
 	return &UserHandler{
-		db:           db,
-		emailService: emailService,
+		db:        db,
+		notifier:  notifier,
+		baseURL:   baseURL,
+		passwords: passwords,
+		twoFactor: twoFactor,
+		jwt:       jwt,
 	}
 }
 
@@ -32,7 +43,8 @@ func NewUserHandler(db *gorm.DB, emailService *services.EmailService) *UserHandl
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"` // 长度和字符要求由密码策略检查
+	Locale   string `json:"locale" binding:"max=35"`     // 邮件语言，未提供时根据Accept-Language推断
 }
 
 // LoginRequest 登录请求
@@ -41,6 +53,13 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// TwoFactorLoginRequest 登录第二步请求，code为验证器中的动态码或一次性恢复码
+// JWT模式下不使用Cookie的客户端携带第一步返回的two_factor_token
+type TwoFactorLoginRequest struct {
+	Code           string `json:"code" binding:"required"`
+	TwoFactorToken string `json:"two_factor_token"`
+}
+
 // generateVerificationToken 生成验证令牌
 func generateVerificationToken() (string, error) {
 	bytes := make([]byte, 16)
@@ -51,6 +70,40 @@ func generateVerificationToken() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
+// userRelations 按user_id关联到用户的数据表，注销或清理用户时一并删除
+var userRelations = []interface{}{
+	&models.ContactNotification{},
+	&models.EmergencyContact{},
+	&models.EscalationEvent{},
+	&models.EscalationState{},
+	&models.EscalationStage{},
+	&models.CheckInLinkUse{},
+	&models.VaultReleaseLog{},
+	&models.VaultRecipient{},
+	&models.VaultMessage{},
+	&models.CheckInPause{},
+	&models.NotificationChannel{},
+	&models.WebhookDelivery{},
+	&models.WebhookEndpoint{},
+	&models.EmailOutbox{},
+	&models.EmailOptOut{},
+	&models.PasswordResetToken{},
+	&models.RecoveryCode{},
+	&models.APIToken{},
+	&models.RefreshToken{},
+	&models.RevokedAccessToken{},
+}
+
+// deleteUserRelations 删除用户的关联数据（签到记录和提醒设置除外）
+func deleteUserRelations(tx *gorm.DB, userID uint) error {
+	for _, model := range userRelations {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Register 用户注册
 func (h *UserHandler) Register(c *gin.Context) {
 	var req RegisterRequest
@@ -59,6 +112,11 @@ func (h *UserHandler) Register(c *gin.Context) {
 		return
 	}
 
+	if err := h.passwords.Check(req.Password, req.Username, req.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 检查用户名或邮箱是否已存在（包括软删除的记录）
 	var existingUser models.User
 	if err := h.db.Unscoped().Where("username = ? OR email = ?", req.Username, req.Email).First(&existingUser).Error; err == nil {
@@ -86,6 +144,13 @@ func (h *UserHandler) Register(c *gin.Context) {
 				return
 			}
 
+			// 删除用户的紧急联系人、升级策略等关联数据
+			if err := deleteUserRelations(tx, existingUser.ID); err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clean up existing user relations"})
+				return
+			}
+
 			// 硬删除用户本身
 			if err := tx.Delete(&existingUser).Error; err != nil {
 				tx.Rollback()
@@ -112,29 +177,34 @@ func (h *UserHandler) Register(c *gin.Context) {
 		return
 	}
 
+	// 邮件语言优先使用请求中指定的，否则取浏览器的首选语言
+	locale := models.NormalizeLocale(req.Locale)
+	if locale == "" {
+		locale = models.ParseAcceptLanguage(c.GetHeader("Accept-Language"))
+	}
+
 	// 创建用户
 	user := models.User{
 		Username:                   req.Username,
 		Email:                      req.Email,
-		Password:                   req.Password,
+		Locale:                     locale,
 		EmailVerified:              false,
 		VerificationToken:          verificationToken,
 		VerificationTokenExpiresAt: time.Now().Add(24 * time.Hour), // 令牌24小时内有效
 	}
 
+	if err := user.SetPassword(req.Password, h.passwords.HashCost); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
 	if err := h.db.Create(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
 	// 创建默认签到提醒设置
-	reminder := models.CheckInReminder{
-		UserID:            user.ID,
-		IsEnabled:         true,
-		ReminderFrequency: "daily",
-		ReminderInterval:  24,
-		NextReminder:      time.Now().AddDate(0, 0, 1), // 明天提醒
-	}
+	reminder := models.DefaultReminder(user.ID) // 明天提醒
 
 	if err := h.db.Create(&reminder).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reminder settings"})
@@ -142,12 +212,19 @@ func (h *UserHandler) Register(c *gin.Context) {
 	}
 
 	// 发送欢迎邮件
-	go func() {
-		if err := h.emailService.SendWelcomeEmail(&user); err != nil {
-			// 记录错误但不影响注册流程
-			// 可以添加日志记录
-		}
-	}()
+	err = h.notifier.Dispatch(&services.Notification{
+		Event:    models.NotificationEventWelcome,
+		User:     &user,
+		Template: "welcome",
+		Data: map[string]interface{}{
+			"Username": user.Username,
+			"Email":    user.Email,
+		},
+	})
+	if err != nil {
+		// 记录错误但不影响注册流程
+		log.Printf("Error queueing welcome email for user %d: %v", user.ID, err)
+	}
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message":        "User registered successfully. You can now login.",
@@ -177,13 +254,118 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// 设置session
-	middleware.SetSession(c, user.ID, user.Username)
+	// 密码哈希参数修改后，用已验证的明文按新参数重新加密，失败不影响登录
+	if user.NeedsRehash(h.passwords.HashCost) {
+		if err := user.SetPassword(req.Password, h.passwords.HashCost); err == nil {
+			if err := h.db.Model(&user).Update("password", user.Password).Error; err != nil {
+				log.Printf("Error re-hashing password for user %d: %v", user.ID, err)
+			}
+		}
+	}
+
+	// 开启了两步验证时先设置待验证的session，提交动态码后才能访问其他接口
+	if user.TOTPEnabled {
+		middleware.SetPendingSession(c, user.ID, user.Username, user.SessionVersion)
+		response := gin.H{
+			"message":             "Two-factor authentication required",
+			"two_factor_required": true,
+		}
+		if h.jwt != nil {
+			token, err := h.jwt.IssueTwoFactorToken(&user)
+			if err != nil {
+				log.Printf("Error issuing two-factor token for user %d: %v", user.ID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to login"})
+				return
+			}
+			response["two_factor_token"] = token
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{
+	h.completeLogin(c, &user)
+}
+
+// completeLogin 设置session，JWT模式下同时签发访问令牌和刷新令牌
+func (h *UserHandler) completeLogin(c *gin.Context, user *models.User) {
+	middleware.SetSession(c, user.ID, user.Username, user.SessionVersion)
+
+	response := gin.H{
 		"message": "Login successful",
 		"user":    user.ToSafeUser(),
-	})
+	}
+	if h.jwt != nil {
+		tokens, err := h.jwt.IssueTokens(user)
+		if err != nil {
+			log.Printf("Error issuing tokens for user %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to login"})
+			return
+		}
+		response["tokens"] = tokens
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// LoginTwoFactor 登录第二步，校验动态码或恢复码后完成登录
+func (h *UserHandler) LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := h.pendingTwoFactorUser(c, req.TwoFactorToken)
+	if !ok {
+		middleware.ClearSession(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login session expired, please login again"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		middleware.ClearSession(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login session expired, please login again"})
+		return
+	}
+
+	if err := h.twoFactor.Verify(&user, req.Code); err != nil {
+		switch err {
+		case services.ErrInvalidTwoFactorCode:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		case services.ErrTwoFactorLocked:
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many invalid codes, please try again later"})
+		case services.ErrTwoFactorDisabled:
+			// 输入密码后两步验证被关闭，需要重新登录
+			middleware.ClearSession(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Login session expired, please login again"})
+		default:
+			log.Printf("Error verifying two-factor code for user %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify two-factor code"})
+		}
+		return
+	}
+
+	h.completeLogin(c, &user)
+}
+
+// pendingTwoFactorUser 返回等待两步验证的用户，优先使用请求中的two_factor_token，否则使用session
+func (h *UserHandler) pendingTwoFactorUser(c *gin.Context, twoFactorToken string) (uint, bool) {
+	if twoFactorToken == "" || h.jwt == nil {
+		return middleware.PendingUserID(c)
+	}
+
+	claims, err := h.jwt.ParseTwoFactorToken(twoFactorToken)
+	if err != nil {
+		return 0, false
+	}
+
+	// 签发后修改或重置了密码的令牌不再有效
+	var user models.User
+	if err := h.db.Select("id, session_version").First(&user, claims.UserID()).Error; err != nil || user.SessionVersion != claims.SessionVersion {
+		return 0, false
+	}
+	return user.ID, true
 }
 
 // GetProfile 获取用户信息
@@ -203,10 +385,14 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 
 // UpdateProfileRequest 更新用户信息请求
 type UpdateProfileRequest struct {
-	Email string `json:"email" binding:"omitempty,email"`
+	Email           string  `json:"email" binding:"omitempty,email"`
+	CurrentPassword string  `json:"current_password"` // 修改邮箱时必填
+	Timezone        *string `json:"timezone" binding:"omitempty,max=64"`
+	Locale          *string `json:"locale" binding:"omitempty,max=35"`
 }
 
 // UpdateProfile 更新用户信息
+// 修改邮箱需要验证当前密码，新邮箱需要重新验证，其他设备上的会话随之失效
 func (h *UserHandler) UpdateProfile(c *gin.Context) {
 	userID := c.GetUint("user_id")
 
@@ -223,23 +409,130 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 	}
 
 	// 更新邮箱（如果提供）
-	if req.Email != "" {
+	// 找回密码的邮件发送到账户邮箱，只凭会话就能修改邮箱等于可以接管账户
+	emailChanged := req.Email != "" && req.Email != user.Email
+	if emailChanged {
+		if req.CurrentPassword == "" || !user.CheckPassword(req.CurrentPassword) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+
+		var count int64
+		h.db.Unscoped().Model(&models.User{}).Where("email = ? AND id <> ?", req.Email, user.ID).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+			return
+		}
+
+		verificationToken, err := generateVerificationToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate verification token"})
+			return
+		}
+
 		user.Email = req.Email
+		user.EmailVerified = false
+		user.VerificationToken = verificationToken
+		user.VerificationTokenExpiresAt = time.Now().Add(24 * time.Hour) // 令牌24小时内有效
 	}
 
-	if err := h.db.Save(&user).Error; err != nil {
+	// 更新时区（如果提供），空字符串表示使用服务器时区
+	if req.Timezone != nil {
+		if *req.Timezone != "" {
+			if _, err := time.LoadLocation(*req.Timezone); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone, expected an IANA name such as Asia/Shanghai"})
+				return
+			}
+		}
+		user.Timezone = *req.Timezone
+	}
+
+	// 更新邮件语言（如果提供），空字符串表示使用默认模板
+	if req.Locale != nil {
+		locale := models.NormalizeLocale(*req.Locale)
+		if *req.Locale != "" && locale == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid locale, expected a language tag such as zh-CN or en"})
+			return
+		}
+		user.Locale = locale
+	}
+
+	if !emailChanged {
+		if err := h.db.Save(&user).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Profile updated successfully",
+			"user":    user.ToSafeUser(),
+		})
+		return
+	}
+
+	tx := h.db.Begin()
+
+	if err := tx.Save(&user).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Profile updated successfully",
+	// 递增会话版本使其他设备上的会话失效
+	if err := tx.Model(&user).Update("session_version", gorm.Expr("session_version + 1")).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	// 发送到原邮箱的找回密码链接不再有效
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	user.SessionVersion++
+	middleware.SetSession(c, user.ID, user.Username, user.SessionVersion)
+
+	response := gin.H{
+		"message": "Profile updated successfully. Please verify your new email address. Other sessions have been signed out.",
 		"user":    user.ToSafeUser(),
-	})
+	}
+
+	if err := h.queueVerificationEmail(&user); err != nil {
+		log.Printf("Error queueing verification email for user %d: %v", user.ID, err)
+		response["warning"] = "Failed to send the verification email, please request a new one"
+	}
+
+	// 使用JWT登录的客户端原有令牌已随会话版本失效，换发新的令牌
+	if _, ok := middleware.JWTClaims(c); ok && h.jwt != nil {
+		tokens, err := h.jwt.IssueTokens(&user)
+		if err != nil {
+			log.Printf("Error issuing tokens for user %d: %v", user.ID, err)
+		} else {
+			response["tokens"] = tokens
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
-// Logout 用户登出
+// Logout 用户登出，使用JWT登录时吊销当前访问令牌及其刷新令牌
 func (h *UserHandler) Logout(c *gin.Context) {
+	if claims, ok := middleware.JWTClaims(c); ok && h.jwt != nil {
+		if err := h.jwt.Revoke(claims); err != nil {
+			log.Printf("Error revoking access token for user %d: %v", claims.UserID(), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+			return
+		}
+	}
+
 	middleware.ClearSession(c)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Logout successful",
@@ -277,6 +570,13 @@ func (h *UserHandler) Cancel(c *gin.Context) {
 		return
 	}
 
+	// 删除用户的紧急联系人、升级策略等关联数据
+	if err := deleteUserRelations(tx, userID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user relations"})
+		return
+	}
+
 	// 删除用户本身
 	if err := tx.Delete(&models.User{}, userID).Error; err != nil {
 		tx.Rollback()
@@ -314,15 +614,23 @@ func (h *UserHandler) SendTestEmail(c *gin.Context) {
 	}
 
 	// 发送测试邮件
-	go func() {
-		if err := h.emailService.SendTestEmail(&user); err != nil {
-			// 记录错误但不影响响应
-			// 可以添加日志记录
-		}
-	}()
+	err := h.notifier.Dispatch(&services.Notification{
+		Event:    models.NotificationEventTest,
+		User:     &user,
+		Template: "test_email",
+		Data: map[string]interface{}{
+			"Username": user.Username,
+		},
+		Channel: models.NotificationChannelEmail,
+	})
+	if err != nil {
+		log.Printf("Error queueing test email for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "测试邮件发送失败"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "测试邮件已发送，请检查您的邮箱",
+		"message": "测试邮件已加入发送队列，请检查您的邮箱，发送状态可在 /api/emails 查看",
 	})
 }
 
@@ -364,19 +672,33 @@ func (h *UserHandler) SendVerificationEmail(c *gin.Context) {
 	}
 
 	// 发送验证邮件
-	verificationURL := c.Request.Host + "/api/verify-email?token=" + verificationToken
-	go func() {
-		if err := h.emailService.SendEmailVerification(&user, verificationURL); err != nil {
-			// 记录错误但不影响响应
-			// 可以添加日志记录
-		}
-	}()
+	if err := h.queueVerificationEmail(&user); err != nil {
+		log.Printf("Error queueing verification email for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Verification email sent. Please check your inbox and spam folder.",
 	})
 }
 
+// queueVerificationEmail 向账户邮箱发送包含user.VerificationToken的验证邮件
+func (h *UserHandler) queueVerificationEmail(user *models.User) error {
+	// 验证邮件始终发送到账户邮箱
+	return h.notifier.Dispatch(&services.Notification{
+		Event:    models.NotificationEventVerification,
+		User:     user,
+		Template: "email_verification",
+		Data: map[string]interface{}{
+			"Username":        user.Username,
+			"VerificationURL": h.baseURL + "/api/verify-email?token=" + url.QueryEscape(user.VerificationToken),
+		},
+		Channel: models.NotificationChannelEmail,
+		Target:  user.Email,
+	})
+}
+
 // VerifyEmail 验证邮箱
 func (h *UserHandler) VerifyEmail(c *gin.Context) {
 	// 获取验证令牌
@@ -414,3 +736,18 @@ func (h *UserHandler) VerifyEmail(c *gin.Context) {
 		"message": "Email verified successfully. You can now login.",
 	})
 }
+
+// requireVerifiedEmail 检查用户邮箱是否已验证，未验证时直接写入响应
+// 联系人、遗言收件人等地址会收到系统代发的邮件，要求先验证账户邮箱，防止未验证的账户被用来群发邮件
+func requireVerifiedEmail(c *gin.Context, db *gorm.DB, userID uint, message string) bool {
+	var user models.User
+	if err := db.Select("id, email_verified").First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return false
+	}
+	if !user.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": message})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"checkin-system/models"
+	"checkin-system/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 遗言消息的限制，防止新注册的账户把遗言消息当作群发邮件的中转
+const (
+	maxVaultMessagesPerUser   = 10 // 每个用户最多可保存的等待释放的消息数
+	maxVaultRecipientsPerUser = 20 // 每个用户所有等待释放的消息的收件人总数上限
+	minVaultReleaseDays       = 7  // 最短释放天数，与请求中binding的min保持一致
+)
+
+// VaultHandler 遗言消息处理器
+type VaultHandler struct {
+	db           *gorm.DB
+	emailService *services.EmailService
+	vaultCipher  *services.VaultCipher
+}
+
+// NewVaultHandler 创建遗言消息处理器
+func NewVaultHandler(db *gorm.DB, emailService *services.EmailService, vaultCipher *services.VaultCipher) *VaultHandler {
+	return &VaultHandler{
+		db:           db,
+		emailService: emailService,
+		vaultCipher:  vaultCipher,
+	}
+}
+
+// VaultRecipientRequest 遗言消息收件人
+type VaultRecipientRequest struct {
+	Name  string `json:"name" binding:"required,max=100"`
+	Email string `json:"email" binding:"required,email"`
+}
+
+// VaultMessageRequest 创建遗言消息请求
+type VaultMessageRequest struct {
+	Title            string                  `json:"title" binding:"required,max=200"`
+	Body             string                  `json:"body" binding:"required"`
+	ReleaseAfterDays int                     `json:"release_after_days" binding:"required,min=7,max=365"`
+	Recipients       []VaultRecipientRequest `json:"recipients" binding:"required,min=1,max=20,dive"`
+}
+
+// UpdateVaultMessageRequest 更新遗言消息请求
+type UpdateVaultMessageRequest struct {
+	Title            *string                 `json:"title" binding:"omitempty,max=200"`
+	Body             *string                 `json:"body"`
+	ReleaseAfterDays *int                    `json:"release_after_days" binding:"omitempty,min=7,max=365"`
+	Recipients       []VaultRecipientRequest `json:"recipients" binding:"omitempty,max=20,dive"`
+}
+
+// ListMessages 获取遗言消息列表（不含正文）
+func (h *VaultHandler) ListMessages(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var messages []models.VaultMessage
+	if err := h.db.Preload("Recipients").
+		Where("user_id = ?", userID).
+		Order("id ASC").
+		Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch vault messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messages": messages,
+	})
+}
+
+// GetMessage 获取遗言消息详情，包括解密后的正文和释放日志
+func (h *VaultHandler) GetMessage(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	message, ok := h.findMessage(c, userID)
+	if !ok {
+		return
+	}
+
+	body, err := h.vaultCipher.Decrypt(message.EncryptedBody)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decrypt vault message"})
+		return
+	}
+
+	var logs []models.VaultReleaseLog
+	h.db.Where("message_id = ?", message.ID).Order("created_at ASC").Find(&logs)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"body":    body,
+		"logs":    logs,
+	})
+}
+
+// CreateMessage 创建遗言消息
+func (h *VaultHandler) CreateMessage(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req VaultMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.checkQuota(c, userID, 0, len(req.Recipients)) {
+		return
+	}
+
+	encryptedBody, err := h.vaultCipher.Encrypt(req.Body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt vault message"})
+		return
+	}
+
+	message := models.VaultMessage{
+		UserID:           userID,
+		Title:            req.Title,
+		EncryptedBody:    encryptedBody,
+		ReleaseAfterDays: req.ReleaseAfterDays,
+		Status:           models.VaultStatusActive,
+		Recipients:       buildVaultRecipients(userID, req.Recipients),
+	}
+
+	if err := h.db.Create(&message).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create vault message"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":       "Vault message created successfully",
+		"vault_message": message,
+	})
+}
+
+// UpdateMessage 更新遗言消息，仅等待释放的消息可以修改
+func (h *VaultHandler) UpdateMessage(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	message, ok := h.findMessage(c, userID)
+	if !ok {
+		return
+	}
+
+	if message.Status != models.VaultStatusActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only active vault messages can be edited"})
+		return
+	}
+
+	var req UpdateVaultMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipients := len(message.Recipients)
+	if req.Recipients != nil {
+		recipients = len(req.Recipients)
+	}
+	if !h.checkQuota(c, userID, message.ID, recipients) {
+		return
+	}
+
+	if req.Title != nil {
+		message.Title = *req.Title
+	}
+
+	if req.Body != nil {
+		encryptedBody, err := h.vaultCipher.Encrypt(*req.Body)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt vault message"})
+			return
+		}
+		message.EncryptedBody = encryptedBody
+	}
+
+	if req.ReleaseAfterDays != nil {
+		message.ReleaseAfterDays = *req.ReleaseAfterDays
+	}
+
+	tx := h.db.Begin()
+
+	// 提供收件人列表时整体替换
+	if req.Recipients != nil {
+		if err := tx.Where("message_id = ?", message.ID).Delete(&models.VaultRecipient{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update vault recipients"})
+			return
+		}
+		message.Recipients = buildVaultRecipients(userID, req.Recipients)
+	}
+
+	if err := tx.Omit("Recipients").Save(&message).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update vault message"})
+		return
+	}
+
+	if req.Recipients != nil && len(message.Recipients) > 0 {
+		for i := range message.Recipients {
+			message.Recipients[i].MessageID = message.ID
+		}
+		if err := tx.Create(&message.Recipients).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update vault recipients"})
+			return
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update vault message"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Vault message updated successfully",
+		"vault_message": message,
+	})
+}
+
+// PreviewMessage 预览收件人将收到的邮件
+func (h *VaultHandler) PreviewMessage(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	message, ok := h.findMessage(c, userID)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	body, err := h.vaultCipher.Decrypt(message.EncryptedBody)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decrypt vault message"})
+		return
+	}
+
+	previews := make([]gin.H, 0, len(message.Recipients))
+	for _, recipient := range message.Recipients {
+		rendered, err := h.emailService.RenderVaultMessage(&recipient, &user, message.Title, body)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render vault message"})
+			return
+		}
+
+		previews = append(previews, gin.H{
+			"to":      recipient.Email,
+			"subject": rendered.Subject,
+			"body":    rendered.Body,
+			"html":    rendered.HTML,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"previews": previews,
+	})
+}
+
+// RevokeMessage 撤销遗言消息，撤销后不会再被释放
+func (h *VaultHandler) RevokeMessage(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	message, ok := h.findMessage(c, userID)
+	if !ok {
+		return
+	}
+
+	if message.Status != models.VaultStatusActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only active vault messages can be revoked"})
+		return
+	}
+
+	now := time.Now()
+	result := h.db.Model(&models.VaultMessage{}).
+		Where("id = ? AND status = ?", message.ID, models.VaultStatusActive).
+		Updates(map[string]interface{}{"status": models.VaultStatusRevoked, "revoked_at": now})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke vault message"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only active vault messages can be revoked"})
+		return
+	}
+
+	h.db.Create(&models.VaultReleaseLog{
+		MessageID: message.ID,
+		UserID:    userID,
+		Event:     "revoked",
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Vault message revoked successfully",
+	})
+}
+
+// checkQuota 检查用户能否保存遗言消息：邮箱需已验证，等待释放的消息数和收件人总数不超过上限
+// messageID为正在修改的消息，不计入已有数量；不满足时直接写入响应
+func (h *VaultHandler) checkQuota(c *gin.Context, userID, messageID uint, recipients int) bool {
+	if !requireVerifiedEmail(c, h.db, userID, "Please verify your email before creating vault messages") {
+		return false
+	}
+
+	var messages int64
+	h.db.Model(&models.VaultMessage{}).
+		Where("user_id = ? AND status = ? AND id <> ?", userID, models.VaultStatusActive, messageID).
+		Count(&messages)
+	if messageID == 0 && messages >= maxVaultMessagesPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d active vault messages are allowed", maxVaultMessagesPerUser)})
+		return false
+	}
+
+	var existing int64
+	h.db.Model(&models.VaultRecipient{}).
+		Joins("JOIN vault_messages ON vault_messages.id = vault_recipients.message_id").
+		Where("vault_messages.user_id = ? AND vault_messages.status = ? AND vault_messages.id <> ?", userID, models.VaultStatusActive, messageID).
+		Count(&existing)
+	if int(existing)+recipients > maxVaultRecipientsPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d recipients across all active vault messages are allowed", maxVaultRecipientsPerUser)})
+		return false
+	}
+
+	return true
+}
+
+// findMessage 根据路径参数查找当前用户的遗言消息，找不到时直接写入响应
+func (h *VaultHandler) findMessage(c *gin.Context, userID uint) (models.VaultMessage, bool) {
+	var message models.VaultMessage
+
+	id, err := parseInt(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message id"})
+		return message, false
+	}
+
+	if err := h.db.Preload("Recipients").Where("id = ? AND user_id = ?", id, userID).First(&message).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vault message not found"})
+		return message, false
+	}
+
+	return message, true
+}
+
+// buildVaultRecipients 将请求中的收件人转换为模型
+func buildVaultRecipients(userID uint, requests []VaultRecipientRequest) []models.VaultRecipient {
+	recipients := make([]models.VaultRecipient, 0, len(requests))
+	for _, r := range requests {
+		recipients = append(recipients, models.VaultRecipient{
+			UserID: userID,
+			Name:   r.Name,
+			Email:  r.Email,
+		})
+	}
+	return recipients
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"checkin-system/models"
+	"checkin-system/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxWebhooksPerUser 每个用户最多可注册的webhook端点数
+const maxWebhooksPerUser = 10
+
+// WebhookHandler 出站webhook处理器
+type WebhookHandler struct {
+	db *gorm.DB
+}
+
+// NewWebhookHandler 创建出站webhook处理器
+func NewWebhookHandler(db *gorm.DB) *WebhookHandler {
+	return &WebhookHandler{
+		db: db,
+	}
+}
+
+// WebhookRequest 注册webhook端点请求
+type WebhookRequest struct {
+	URL         string   `json:"url" binding:"required,max=500"`
+	Description string   `json:"description" binding:"max=100"`
+	Events      []string `json:"events"`
+	IsEnabled   *bool    `json:"is_enabled"`
+}
+
+// UpdateWebhookRequest 更新webhook端点请求
+type UpdateWebhookRequest struct {
+	URL          *string   `json:"url" binding:"omitempty,max=500"`
+	Description  *string   `json:"description" binding:"omitempty,max=100"`
+	Events       *[]string `json:"events"`
+	IsEnabled    *bool     `json:"is_enabled"`
+	RotateSecret bool      `json:"rotate_secret"` // 生成新的签名密钥，旧密钥立即失效
+}
+
+// ListWebhooks 获取webhook端点列表
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var endpoints []models.WebhookEndpoint
+	if err := h.db.Where("user_id = ?", userID).Order("id ASC").Find(&endpoints).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": endpoints,
+		"events":   models.WebhookEvents,
+	})
+}
+
+// CreateWebhook 注册webhook端点，签名密钥只在此时返回
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	h.db.Model(&models.WebhookEndpoint{}).Where("user_id = ?", userID).Count(&count)
+	if count >= maxWebhooksPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d webhooks are allowed", maxWebhooksPerUser)})
+		return
+	}
+
+	secret, err := services.GenerateWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate webhook secret"})
+		return
+	}
+
+	endpoint := models.WebhookEndpoint{
+		UserID:      userID,
+		URL:         req.URL,
+		Description: req.Description,
+		Secret:      secret,
+		Events:      req.Events,
+		IsEnabled:   true,
+	}
+	if req.IsEnabled != nil {
+		endpoint.IsEnabled = *req.IsEnabled
+	}
+
+	if err := validateWebhook(&endpoint); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db.Create(&endpoint).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	// 创建时布尔零值会被替换为字段默认值，需要单独更新
+	if req.IsEnabled != nil && !*req.IsEnabled {
+		endpoint.IsEnabled = false
+		h.db.Model(&endpoint).Update("is_enabled", false)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Webhook created successfully",
+		"webhook": endpoint,
+		"secret":  secret,
+	})
+}
+
+// UpdateWebhook 更新webhook端点
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	endpoint, ok := h.findWebhook(c, userID)
+	if !ok {
+		return
+	}
+
+	var req UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.URL != nil {
+		endpoint.URL = *req.URL
+	}
+
+	if req.Description != nil {
+		endpoint.Description = *req.Description
+	}
+
+	if req.Events != nil {
+		endpoint.Events = *req.Events
+	}
+
+	if req.IsEnabled != nil {
+		endpoint.IsEnabled = *req.IsEnabled
+	}
+
+	if err := validateWebhook(&endpoint); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"message": "Webhook updated successfully",
+	}
+
+	if req.RotateSecret {
+		secret, err := services.GenerateWebhookSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate webhook secret"})
+			return
+		}
+		endpoint.Secret = secret
+		response["secret"] = secret
+	}
+
+	if err := h.db.Save(&endpoint).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+
+	response["webhook"] = endpoint
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteWebhook 删除webhook端点及其投递记录
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	endpoint, ok := h.findWebhook(c, userID)
+	if !ok {
+		return
+	}
+
+	tx := h.db.Begin()
+
+	if err := tx.Where("endpoint_id = ?", endpoint.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook deliveries"})
+		return
+	}
+
+	if err := tx.Delete(&endpoint).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Webhook deleted successfully",
+	})
+}
+
+// ListWebhookDeliveries 获取webhook端点的投递记录
+func (h *WebhookHandler) ListWebhookDeliveries(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	endpoint, ok := h.findWebhook(c, userID)
+	if !ok {
+		return
+	}
+
+	listWebhookDeliveries(c, h.db.Where("endpoint_id = ?", endpoint.ID))
+}
+
+// listWebhookDeliveries 按查询参数过滤并返回投递记录，webhook端点和webhook通知渠道共用
+func listWebhookDeliveries(c *gin.Context, query *gorm.DB) {
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := parseInt(l); err == nil && parsed > 0 && parsed <= 200 {
+			limit = parsed
+		}
+	}
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhook deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+	})
+}
+
+// findWebhook 根据路径参数查找当前用户的webhook端点，找不到时直接写入响应
+func (h *WebhookHandler) findWebhook(c *gin.Context, userID uint) (models.WebhookEndpoint, bool) {
+	var endpoint models.WebhookEndpoint
+
+	id, err := parseInt(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook id"})
+		return endpoint, false
+	}
+
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).First(&endpoint).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return endpoint, false
+	}
+
+	return endpoint, true
+}
+
+// validateWebhook 校验端点地址和订阅事件，地址必须解析到公网IP
+func validateWebhook(endpoint *models.WebhookEndpoint) error {
+	if err := services.CheckPublicURL(endpoint.URL); err != nil {
+		return fmt.Errorf("webhook url %v", err)
+	}
+
+	for _, event := range endpoint.Events {
+		if !models.IsWebhookEvent(event) {
+			return fmt.Errorf("unsupported event %q", event)
+		}
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"log"
 	"os"
+	"time"
+	_ "time/tzdata" // 内置时区数据，保证在没有系统时区库的环境中也能解析用户时区
 
 	"checkin-system/config"
 	"checkin-system/database"
@@ -26,22 +28,98 @@ func main() {
 	// 初始化数据库
 	db := database.InitDB()
 
+	// 清理旧索引
+	if err := database.DropLegacyIndexes(db); err != nil {
+		log.Fatal("Failed to drop legacy indexes:", err)
+	}
+
 	// 自动迁移数据库表
 	err := db.AutoMigrate(
 		&models.User{},
 		&models.CheckIn{},
 		&models.CheckInReminder{},
+		&models.EmergencyContact{},
+		&models.ContactNotification{},
+		&models.EscalationStage{},
+		&models.EscalationState{},
+		&models.EscalationEvent{},
+		&models.CheckInLinkUse{},
+		&models.VaultMessage{},
+		&models.VaultRecipient{},
+		&models.VaultReleaseLog{},
+		&models.CheckInPause{},
+		&models.NotificationChannel{},
+		&models.WebhookEndpoint{},
+		&models.WebhookDelivery{},
+		&models.EmailOutbox{},
+		&models.EmailOptOut{},
+		&models.PasswordResetToken{},
+		&models.RecoveryCode{},
+		&models.APIToken{},
+		&models.RefreshToken{},
+		&models.RevokedAccessToken{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
 	// 初始化服务
-	emailService := services.NewEmailService(config.GetEmailConfig())
-	schedulerService := services.NewSchedulerService(db, emailService)
+	appConfig := config.GetAppConfig()
+	if err := appConfig.Validate(); err != nil {
+		log.Fatal("Invalid app config: ", err)
+	}
+	if appConfig.VaultKey == "" {
+		// 只有开发环境允许不配置，使用固定的开发密钥，加密的数据不能带到生产环境
+		log.Println("Warning: VAULT_KEY not set, using an insecure development key for vault encryption")
+		appConfig.VaultKey = "development-only-vault-key"
+	}
+	if appConfig.LinkSecret == "" {
+		log.Println("Warning: LINK_SECRET not set, using an insecure development key for email links")
+		appConfig.LinkSecret = "development-only-link-secret"
+	}
+	vaultCipher, err := services.NewVaultCipher(appConfig.VaultKey)
+	if err != nil {
+		log.Fatal("Failed to initialize vault cipher:", err)
+	}
+
+	passwordPolicy := config.GetPasswordPolicy()
+	if err := passwordPolicy.Validate(); err != nil {
+		log.Fatal("Invalid password policy: ", err)
+	}
+
+	jwtConfig := config.GetJWTConfig()
+	if err := jwtConfig.Validate(); err != nil {
+		log.Fatal("Invalid JWT config: ", err)
+	}
+
+	emailConfig := config.GetEmailConfig()
+	if err := emailConfig.Validate(); err != nil {
+		log.Fatal("Invalid email configuration: ", err)
+	}
+	if emailConfig.Transport != config.MailTransportSMTP && !appConfig.IsDevelopment() {
+		log.Printf("Warning: MAIL_TRANSPORT=%s, emails will not be delivered to recipients", emailConfig.Transport)
+	}
+
+	emailService := services.NewEmailService(db, emailConfig)
+	checkInLinkService := services.NewCheckInLinkService(appConfig)
+	unsubscribeService := services.NewUnsubscribeService(appConfig)
+	webhookService := services.NewWebhookService(db)
+	notificationRouter := services.NewNotificationRouter(db, emailService, webhookService, unsubscribeService)
+	twoFactorService := services.NewTwoFactorService(db, vaultCipher, appConfig.TOTPIssuer)
+	// 设置JWT_SECRET后启用JWT模式，登录同时返回访问令牌和刷新令牌
+	var jwtService *services.JWTService
+	if jwtConfig.Enabled() {
+		jwtService = services.NewJWTService(db, jwtConfig)
+		middleware.UseJWT(jwtService)
+	}
+	schedulerService := services.NewSchedulerService(db, notificationRouter, checkInLinkService, vaultCipher, webhookService)
 	
-	// 启动定时任务
+	// 启动定时任务和发件箱任务
 	go schedulerService.Start()
+	emailService.StartOutboxWorker()
+
+	// 监视邮件模板文件，修改后自动重新加载
+	emailService.WatchTemplates(2 * time.Second)
 
 	// 初始化路由
 	r := gin.Default()
@@ -63,9 +141,20 @@ func main() {
 	r.Static("/static", "./static")
 
 	// 初始化处理器
-	userHandler := handlers.NewUserHandler(db, emailService)
-	checkInHandler := handlers.NewCheckInHandler(db)
+	userHandler := handlers.NewUserHandler(db, notificationRouter, appConfig.BaseURL, passwordPolicy, twoFactorService, jwtService)
+	checkInHandler := handlers.NewCheckInHandler(db, checkInLinkService, webhookService)
 	reminderHandler := handlers.NewReminderHandler(db)
+	contactHandler := handlers.NewContactHandler(db)
+	escalationHandler := handlers.NewEscalationHandler(db, emailService)
+	vaultHandler := handlers.NewVaultHandler(db, emailService, vaultCipher)
+	pauseHandler := handlers.NewPauseHandler(db)
+	notificationHandler := handlers.NewNotificationHandler(db, notificationRouter, appConfig.BaseURL)
+	webhookHandler := handlers.NewWebhookHandler(db)
+	emailHandler := handlers.NewEmailHandler(db, emailService)
+	templateHandler := handlers.NewTemplateHandler(emailService)
+	unsubscribeHandler := handlers.NewUnsubscribeHandler(db, unsubscribeService)
+	twoFactorHandler := handlers.NewTwoFactorHandler(db, twoFactorService)
+	apiTokenHandler := handlers.NewAPITokenHandler(db)
 
 	// API路由组
 	api := r.Group("/api")
@@ -73,30 +162,127 @@ func main() {
 		// 用户相关
         api.POST("/register", userHandler.Register)
         api.POST("/login", userHandler.Login)
+        api.POST("/login/2fa", userHandler.LoginTwoFactor)
         api.GET("/verify-email", userHandler.VerifyEmail)
         api.POST("/logout", middleware.AuthMiddleware(), userHandler.Logout)
-        api.GET("/profile", middleware.AuthMiddleware(), userHandler.GetProfile)
+        api.GET("/profile", middleware.AuthMiddleware(models.APIScopeProfileRead), userHandler.GetProfile)
         api.PUT("/profile", middleware.AuthMiddleware(), userHandler.UpdateProfile)
         api.POST("/test-email", middleware.AuthMiddleware(), userHandler.SendTestEmail)
         api.POST("/cancel", middleware.AuthMiddleware(), userHandler.Cancel)
         api.POST("/send-verification", middleware.AuthMiddleware(), userHandler.SendVerificationEmail)
+        api.POST("/password/forgot", userHandler.ForgotPassword)
+        api.POST("/password/reset", userHandler.ResetPassword)
+        api.GET("/password/policy", userHandler.GetPasswordPolicy)
+        api.PUT("/password", middleware.AuthMiddleware(), userHandler.ChangePassword)
+
+		// JWT令牌相关（仅JWT模式）
+		if jwtService != nil {
+			api.POST("/token/refresh", userHandler.RefreshToken)
+			api.POST("/token/revoke", userHandler.RevokeToken)
+		}
+
+		// 两步验证相关
+		api.GET("/2fa", middleware.AuthMiddleware(), twoFactorHandler.GetStatus)
+		api.POST("/2fa/setup", middleware.AuthMiddleware(), twoFactorHandler.Setup)
+		api.POST("/2fa/enable", middleware.AuthMiddleware(), twoFactorHandler.Enable)
+		api.POST("/2fa/disable", middleware.AuthMiddleware(), twoFactorHandler.Disable)
+		api.POST("/2fa/recovery-codes", middleware.AuthMiddleware(), twoFactorHandler.RegenerateRecoveryCodes)
+
+		// 个人API令牌相关（只能通过登录会话管理）
+		api.GET("/tokens", middleware.AuthMiddleware(), apiTokenHandler.ListAPITokens)
+		api.POST("/tokens", middleware.AuthMiddleware(), apiTokenHandler.CreateAPIToken)
+		api.DELETE("/tokens/:id", middleware.AuthMiddleware(), apiTokenHandler.RevokeAPIToken)
+
+		// 发件箱相关
+		api.GET("/emails", middleware.AuthMiddleware(), emailHandler.ListEmails)
+		api.GET("/emails/:id", middleware.AuthMiddleware(), emailHandler.GetEmail)
+		api.POST("/emails/:id/resend", middleware.AuthMiddleware(), emailHandler.ResendEmail)
 
 		// 签到相关
-		api.POST("/checkin", middleware.AuthMiddleware(), checkInHandler.CheckIn)
-		api.GET("/checkin/history", middleware.AuthMiddleware(), checkInHandler.GetCheckInHistory)
-		api.GET("/checkin/status", middleware.AuthMiddleware(), checkInHandler.GetCheckInStatus)
+		api.POST("/checkin", middleware.AuthMiddleware(models.APIScopeCheckInWrite), checkInHandler.CheckIn)
+		api.GET("/checkin/history", middleware.AuthMiddleware(models.APIScopeHistoryRead), checkInHandler.GetCheckInHistory)
+		api.GET("/checkin/status", middleware.AuthMiddleware(models.APIScopeCheckInRead), checkInHandler.GetCheckInStatus)
+		api.GET("/checkin/link", checkInHandler.CheckInLinkPage)
+		api.POST("/checkin/link", checkInHandler.CheckInByLink)
+
+		// 退订路由，退订链接无需登录
+		api.GET("/unsubscribe", unsubscribeHandler.UnsubscribePage)
+		api.POST("/unsubscribe", unsubscribeHandler.Unsubscribe)
+		api.GET("/unsubscribes", middleware.AuthMiddleware(), unsubscribeHandler.ListOptOuts)
+		api.DELETE("/unsubscribes/:id", middleware.AuthMiddleware(), unsubscribeHandler.DeleteOptOut)
 
 		// 提醒相关
 		api.GET("/reminder", middleware.AuthMiddleware(), reminderHandler.GetReminder)
 		api.PUT("/reminder", middleware.AuthMiddleware(), reminderHandler.UpdateReminder)
+		api.GET("/reminders", middleware.AuthMiddleware(), reminderHandler.ListReminders)
+		api.POST("/reminders", middleware.AuthMiddleware(), reminderHandler.CreateReminder)
+		api.PUT("/reminders/:id", middleware.AuthMiddleware(), reminderHandler.UpdateReminderByID)
+		api.DELETE("/reminders/:id", middleware.AuthMiddleware(), reminderHandler.DeleteReminder)
+
+		// 暂停（休假）模式相关
+		api.GET("/pauses", middleware.AuthMiddleware(models.APIScopePauseRead), pauseHandler.ListPauses)
+		api.POST("/pauses", middleware.AuthMiddleware(models.APIScopePauseWrite), pauseHandler.CreatePause)
+		api.POST("/pauses/:id/resume", middleware.AuthMiddleware(models.APIScopePauseWrite), pauseHandler.ResumePause)
+
+		// 通知渠道相关
+		api.GET("/channels", middleware.AuthMiddleware(), notificationHandler.ListChannels)
+		api.POST("/channels", middleware.AuthMiddleware(), notificationHandler.CreateChannel)
+		api.PUT("/channels/:id", middleware.AuthMiddleware(), notificationHandler.UpdateChannel)
+		api.DELETE("/channels/:id", middleware.AuthMiddleware(), notificationHandler.DeleteChannel)
+		api.POST("/channels/:id/test", middleware.AuthMiddleware(), notificationHandler.TestChannel)
+		api.GET("/channels/:id/deliveries", middleware.AuthMiddleware(), notificationHandler.ListChannelDeliveries)
+		api.POST("/channels/:id/verification", middleware.AuthMiddleware(), notificationHandler.ResendVerification)
+		api.GET("/channels/verify", notificationHandler.VerifyChannel)
+
+		// 出站webhook相关
+		api.GET("/webhooks", middleware.AuthMiddleware(), webhookHandler.ListWebhooks)
+		api.POST("/webhooks", middleware.AuthMiddleware(), webhookHandler.CreateWebhook)
+		api.PUT("/webhooks/:id", middleware.AuthMiddleware(), webhookHandler.UpdateWebhook)
+		api.DELETE("/webhooks/:id", middleware.AuthMiddleware(), webhookHandler.DeleteWebhook)
+		api.GET("/webhooks/:id/deliveries", middleware.AuthMiddleware(), webhookHandler.ListWebhookDeliveries)
+
+		// 紧急联系人相关
+		api.GET("/contacts", middleware.AuthMiddleware(), contactHandler.ListContacts)
+		api.POST("/contacts", middleware.AuthMiddleware(), contactHandler.CreateContact)
+		api.PUT("/contacts/:id", middleware.AuthMiddleware(), contactHandler.UpdateContact)
+		api.DELETE("/contacts/:id", middleware.AuthMiddleware(), contactHandler.DeleteContact)
+
+		// 升级策略相关
+		api.GET("/escalation", middleware.AuthMiddleware(), escalationHandler.GetEscalation)
+		api.PUT("/escalation", middleware.AuthMiddleware(), escalationHandler.UpdateEscalation)
+		api.GET("/escalation/history", middleware.AuthMiddleware(), escalationHandler.GetEscalationHistory)
+
+		// 遗言消息相关
+		api.GET("/vault", middleware.AuthMiddleware(), vaultHandler.ListMessages)
+		api.POST("/vault", middleware.AuthMiddleware(), vaultHandler.CreateMessage)
+		api.GET("/vault/:id", middleware.AuthMiddleware(), vaultHandler.GetMessage)
+		api.PUT("/vault/:id", middleware.AuthMiddleware(), vaultHandler.UpdateMessage)
+		api.GET("/vault/:id/preview", middleware.AuthMiddleware(), vaultHandler.PreviewMessage)
+		api.POST("/vault/:id/revoke", middleware.AuthMiddleware(), vaultHandler.RevokeMessage)
+
+		// 邮件模板管理（仅管理员）
+		admin := api.Group("/admin", middleware.AuthMiddleware(), middleware.AdminMiddleware(appConfig.AdminUsers))
+		admin.GET("/templates", templateHandler.ListTemplates)
+		admin.GET("/templates/:key", templateHandler.GetTemplate)
+		admin.PUT("/templates/:key", templateHandler.UpdateTemplate)
+		admin.POST("/templates/:key/validate", templateHandler.ValidateTemplate)
+		admin.GET("/templates/:key/preview", templateHandler.PreviewTemplate)
+		admin.POST("/templates/:key/preview", templateHandler.PreviewTemplate)
 	}
 
 	// 页面路由
 	r.GET("/", handlers.IndexHandler)
 	r.GET("/login", handlers.LoginPageHandler)
 	r.GET("/register", handlers.RegisterPageHandler)
+	r.GET("/reset-password", handlers.ResetPasswordPageHandler)
 	r.GET("/dashboard", middleware.AuthMiddleware(), handlers.DashboardHandler)
 
+	// 开发环境辅助页面
+	if appConfig.IsDevelopment() {
+		devHandler := handlers.NewDevHandler(emailService)
+		r.GET("/dev/mailbox", devHandler.Mailbox)
+	}
+
 	// 启动服务器
 	port := os.Getenv("SERVER_PORT")
 	if port == "" {
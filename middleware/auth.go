@@ -2,16 +2,39 @@ package middleware
 
 import (
 	"checkin-system/database"
+	"checkin-system/models"
+	"checkin-system/services"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 
 )
 
-// AuthMiddleware Session认证中间件
-func AuthMiddleware() gin.HandlerFunc {
+// jwtService 启用JWT模式后用于校验访问令牌，为nil时Bearer令牌只能是个人API令牌
+var jwtService *services.JWTService
+
+// UseJWT 启用JWT模式，AuthMiddleware随之接受Bearer方式携带的JWT访问令牌
+func UseJWT(s *services.JWTService) {
+	jwtService = s
+}
+
+// AuthMiddleware 认证中间件，支持Session、JWT访问令牌和个人API令牌（后两者使用Authorization: Bearer）
+// JWT与Session等同于用户本人登录；scopes为API令牌访问该路由所需的权限范围，未声明权限范围的路由不接受API令牌
+func AuthMiddleware(scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if token, ok := bearerToken(c); ok {
+			if jwtService != nil && !strings.HasPrefix(token, models.APITokenPrefix) {
+				authenticateJWT(c, token)
+			} else {
+				authenticateAPIToken(c, token, scopes)
+			}
+			return
+		}
+
 		session := sessions.Default(c)
 
 		// 检查session中是否有用户ID
@@ -26,17 +49,9 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 验证用户是否存在
-		var user struct {
-			ID       uint   `json:"id"`
-			Username string `json:"username"`
-		}
-
-		db := database.GetDB()
-		if err := db.Model(&struct {
-			ID       uint   `json:"id"`
-			Username string `json:"username"`
-		}{}).Table("users").Select("id, username").Where("id = ?", userID).First(&user).Error; err != nil {
+		// 验证用户是否存在，以及会话是否已因重置密码等操作失效
+		user, err := findSessionUser(userID, session.Get("session_version"))
+		if err != nil {
 			if isAPIRequest(c) {
 				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session"})
 			} else {
@@ -49,6 +64,17 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 已输入密码但还未完成两步验证的session只能用于提交动态码
+		if isTwoFactorPending(session) {
+			if isAPIRequest(c) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Two-factor authentication required", "two_factor_required": true})
+			} else {
+				c.Redirect(http.StatusFound, "/login")
+			}
+			c.Abort()
+			return
+		}
+
 		// 设置用户信息到context
 		c.Set("user_id", user.ID)
 		c.Set("username", user.Username)
@@ -58,28 +84,130 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// apiTokenTouchInterval 令牌最近使用时间的最小更新间隔，避免每个请求都写数据库
+const apiTokenTouchInterval = time.Minute
+
+// bearerToken 读取Authorization请求头中的Bearer令牌
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+// authenticateAPIToken 使用个人API令牌认证，令牌需有效且拥有路由要求的全部权限范围
+func authenticateAPIToken(c *gin.Context, secret string, scopes []string) {
+	db := database.GetDB()
+
+	var token models.APIToken
+	if err := db.Where("token_hash = ?", models.HashToken(secret)).First(&token).Error; err != nil || !token.IsActive(time.Now()) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API token"})
+		c.Abort()
+		return
+	}
+
+	if len(scopes) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API tokens are not allowed for this endpoint"})
+		c.Abort()
+		return
+	}
+	if !token.HasScopes(scopes...) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API token is missing required scope", "required_scopes": scopes})
+		c.Abort()
+		return
+	}
+
+	var user sessionUser
+	if err := db.Table("users").Select("id, username, session_version").
+		Where("id = ?", token.UserID).First(&user).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API token"})
+		c.Abort()
+		return
+	}
+
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenTouchInterval {
+		db.Model(&token).Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": c.ClientIP(),
+		})
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("authenticated", true)
+	c.Set("api_token_id", token.ID)
+
+	c.Next()
+}
+
+// authenticateJWT 使用JWT访问令牌认证，用户修改或重置密码后令牌随会话版本一起失效
+func authenticateJWT(c *gin.Context, token string) {
+	claims, err := jwtService.VerifyAccessToken(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired access token"})
+		c.Abort()
+		return
+	}
+
+	user, err := findSessionUser(claims.UserID(), claims.SessionVersion)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired access token"})
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("authenticated", true)
+	c.Set("jwt_claims", claims)
+
+	c.Next()
+}
+
+// JWTClaims 返回当前请求使用的JWT访问令牌，使用Session或API令牌认证时返回false
+func JWTClaims(c *gin.Context) (*services.JWTClaims, bool) {
+	value, ok := c.Get("jwt_claims")
+	if !ok {
+		return nil, false
+	}
+	claims, ok := value.(*services.JWTClaims)
+	return claims, ok
+}
+
+// AdminMiddleware 管理员认证中间件，需在AuthMiddleware之后使用
+func AdminMiddleware(admins []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.GetString("username")
+		for _, admin := range admins {
+			if username != "" && username == admin {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+		c.Abort()
+	}
+}
+
 // OptionalAuthMiddleware 可选认证中间件
 func OptionalAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
 		userID := session.Get("user_id")
 
-		if userID != nil {
-			db := database.GetDB()
-			var user struct {
-				ID       uint   `json:"id"`
-				Username string `json:"username"`
-			}
-
-			if err := db.Model(&struct {
-				ID       uint   `json:"id"`
-				Username string `json:"username"`
-			}{}).Table("users").Select("id, username").Where("id = ?", userID).First(&user).Error; err == nil {
+		if userID != nil && isTwoFactorPending(session) {
+			c.Set("authenticated", false)
+		} else if userID != nil {
+			if user, err := findSessionUser(userID, session.Get("session_version")); err == nil {
 				c.Set("user_id", user.ID)
 				c.Set("username", user.Username)
 				c.Set("authenticated", true)
 			} else {
-				// 用户不存在，清除session
+				// 用户不存在或会话已失效，清除session
 				session.Clear()
 				session.Save()
 				c.Set("authenticated", false)
@@ -97,14 +225,83 @@ func isAPIRequest(c *gin.Context) bool {
 	return len(c.Request.URL.Path) >= 4 && c.Request.URL.Path[:4] == "/api"
 }
 
-// SetSession 设置用户session
-func SetSession(c *gin.Context, userID uint, username string) {
+// errSessionRevoked session已被撤销
+var errSessionRevoked = errors.New("session has been revoked")
+
+// sessionUser session中保存的用户
+type sessionUser struct {
+	ID             uint
+	Username       string
+	SessionVersion int
+}
+
+// findSessionUser 查找session对应的用户，会话版本与用户当前版本不一致时视为失效
+// 旧版本创建的session没有保存版本，按0处理
+func findSessionUser(userID, version interface{}) (*sessionUser, error) {
+	var user sessionUser
+	db := database.GetDB()
+	if err := db.Table("users").Select("id, username, session_version").
+		Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	sessionVersion, _ := version.(int)
+	if sessionVersion != user.SessionVersion {
+		return nil, errSessionRevoked
+	}
+	return &user, nil
+}
+
+// SetSession 设置用户session，记录当前会话版本，用户的会话版本递增后该session失效
+func SetSession(c *gin.Context, userID uint, username string, sessionVersion int) {
+	session := sessions.Default(c)
+	session.Set("user_id", userID)
+	session.Set("username", username)
+	session.Set("session_version", sessionVersion)
+	session.Delete("two_factor_pending")
+	session.Delete("two_factor_started_at")
+	session.Save()
+}
+
+// twoFactorPendingTTL 密码验证通过后，需要在该时长内提交两步验证码
+const twoFactorPendingTTL = 5 * time.Minute
+
+// SetPendingSession 设置等待两步验证的session，AuthMiddleware会拒绝该session，完成两步验证后再调用SetSession
+func SetPendingSession(c *gin.Context, userID uint, username string, sessionVersion int) {
 	session := sessions.Default(c)
 	session.Set("user_id", userID)
 	session.Set("username", username)
+	session.Set("session_version", sessionVersion)
+	session.Set("two_factor_pending", true)
+	session.Set("two_factor_started_at", time.Now().Unix())
 	session.Save()
 }
 
+// PendingUserID 返回等待两步验证的用户，session不存在、已超时或已失效时返回false
+func PendingUserID(c *gin.Context) (uint, bool) {
+	session := sessions.Default(c)
+	if !isTwoFactorPending(session) {
+		return 0, false
+	}
+
+	startedAt, _ := session.Get("two_factor_started_at").(int64)
+	if time.Since(time.Unix(startedAt, 0)) > twoFactorPendingTTL {
+		return 0, false
+	}
+
+	user, err := findSessionUser(session.Get("user_id"), session.Get("session_version"))
+	if err != nil {
+		return 0, false
+	}
+	return user.ID, true
+}
+
+// isTwoFactorPending 检查session是否还在等待两步验证
+func isTwoFactorPending(session sessions.Session) bool {
+	pending, _ := session.Get("two_factor_pending").(bool)
+	return pending
+}
+
 // ClearSession 清除用户session
 func ClearSession(c *gin.Context) {
 	session := sessions.Default(c)
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+)
+
+// APITokenPrefix 个人API令牌的前缀，便于在日志和代码仓库中识别泄露的令牌
+const APITokenPrefix = "cks_"
+
+// API令牌的权限范围
+const (
+	APIScopeCheckInRead  = "checkin:read"  // 查询今日签到状态
+	APIScopeCheckInWrite = "checkin:write" // 签到
+	APIScopeHistoryRead  = "history:read"  // 查询签到历史
+	APIScopePauseRead    = "pause:read"    // 查询暂停（休假）记录
+	APIScopePauseWrite   = "pause:write"   // 开始或结束暂停
+	APIScopeProfileRead  = "profile:read"  // 查询用户信息
+)
+
+// APIScopes 所有可以授予API令牌的权限范围
+var APIScopes = []string{
+	APIScopeCheckInRead,
+	APIScopeCheckInWrite,
+	APIScopeHistoryRead,
+	APIScopePauseRead,
+	APIScopePauseWrite,
+	APIScopeProfileRead,
+}
+
+// APIToken 用户创建的个人API令牌，供脚本、手机快捷指令等以Bearer方式调用接口
+// 只保存令牌的哈希值，明文只在创建时返回一次
+type APIToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	Name       string     `json:"name" gorm:"size:100;not null"`
+	TokenHash  string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Hint       string     `json:"hint" gorm:"size:20"`           // 令牌开头的几个字符，用于在列表中辨认
+	Scopes     []string   `json:"scopes" gorm:"serializer:json"` // 授予的权限范围
+	ExpiresAt  *time.Time `json:"expires_at"`                    // 为空表示不过期
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip" gorm:"size:45"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HasScopes 检查令牌是否拥有全部指定的权限范围
+func (t *APIToken) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		granted := false
+		for _, s := range t.Scopes {
+			if s == scope {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			return false
+		}
+	}
+	return true
+}
+
+// IsActive 检查令牌是否未撤销且未过期
+func (t *APIToken) IsActive(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
+
+// IsAPIScope 检查权限范围是否受支持
+func IsAPIScope(scope string) bool {
+	for _, s := range APIScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -13,41 +13,74 @@ type CheckIn struct {
 }
 
 
-// IsToday 检查是否是今天的签到
-func (c *CheckIn) IsToday() bool {
-	now := time.Now()
-	return c.CheckInAt.Year() == now.Year() &&
-		c.CheckInAt.Month() == now.Month() &&
-		c.CheckInAt.Day() == now.Day()
+// IsToday 检查是否是指定时区中今天的签到
+func (c *CheckIn) IsToday(loc *time.Location) bool {
+	return c.CheckInAt.In(loc).Format("2006-01-02") == time.Now().In(loc).Format("2006-01-02")
 }
 
-// GetConsecutiveDays 获取连续签到天数
-func GetConsecutiveDays(checkIns []CheckIn) int {
+// DayBounds 返回t在指定时区中所在自然日的起止时间 [start, end)
+func DayBounds(t time.Time, loc *time.Location) (time.Time, time.Time) {
+	local := t.In(loc)
+	return LocalDay(local.Year(), local.Month(), local.Day(), loc), LocalDay(local.Year(), local.Month(), local.Day()+1, loc)
+}
+
+// LocalDay 返回指定时区中某个日期的开始时刻，超出范围的日期像time.Date一样进位
+// 午夜因夏令时被跳过时（如America/Santiago），返回当天跳变后的第一个时刻
+func LocalDay(year int, month time.Month, day int, loc *time.Location) time.Time {
+	return wallTime(time.Date(year, month, day, 0, 0, 0, 0, time.UTC), loc)
+}
+
+// GetConsecutiveDays 获取连续签到天数，按用户时区划分日期
+// 今天尚未签到不会中断连续记录，处于暂停期间的日期会被跳过
+// checkIns需要包含连续签到开始以来的所有记录，只有部分记录时使用ConsecutiveDaysSince
+func GetConsecutiveDays(checkIns []CheckIn, pauses []CheckInPause, loc *time.Location) int {
 	if len(checkIns) == 0 {
 		return 0
 	}
 
-	consecutive := 0
-	currentDate := time.Now()
-	
-	for i := len(checkIns) - 1; i >= 0; i-- {
-		checkInDate := checkIns[i].CheckInAt
-		
-		// 检查是否是连续的日期
-		if checkInDate.Year() == currentDate.Year() &&
-			checkInDate.Month() == currentDate.Month() &&
-			checkInDate.Day() == currentDate.Day() {
-			
+	earliest := checkIns[0].CheckInAt
+	for _, checkIn := range checkIns {
+		if checkIn.CheckInAt.Before(earliest) {
+			earliest = checkIn.CheckInAt
+		}
+	}
+
+	consecutive, _ := ConsecutiveDaysSince(checkIns, pauses, loc, earliest.AddDate(0, 0, -1))
+	return consecutive
+}
+
+// ConsecutiveDaysSince 根据since之后的签到记录计算连续签到天数
+// complete为false表示直到since都没有中断，连续签到可能延续到since之前，需要加载更早的记录
+func ConsecutiveDaysSince(checkIns []CheckIn, pauses []CheckInPause, loc *time.Location, since time.Time) (consecutive int, complete bool) {
+	checkedDays := make(map[string]bool, len(checkIns))
+	for _, checkIn := range checkIns {
+		checkedDays[checkIn.CheckInAt.In(loc).Format("2006-01-02")] = true
+	}
+
+	today, _ := DayBounds(time.Now(), loc)
+	for currentDate := today; !currentDate.Before(since); currentDate = LocalDay(currentDate.Year(), currentDate.Month(), currentDate.Day()-1, loc) {
+		if checkedDays[currentDate.Format("2006-01-02")] {
 			consecutive++
-			currentDate = currentDate.AddDate(0, 0, -1)
-		} else if checkInDate.After(currentDate) {
-			// 如果签到日期晚于当前检查日期，跳过
 			continue
-		} else {
-			// 如果不是连续的，中断
-			break
 		}
+
+		// 今天还没结束，或者这一天处于暂停期间，都不算中断
+		if currentDate.Equal(today) || isPausedDay(pauses, currentDate) {
+			continue
+		}
+
+		return consecutive, true
 	}
-	
-	return consecutive
-}
\ No newline at end of file
+
+	return consecutive, false
+}
+
+// isPausedDay 检查某一天是否处于暂停期间
+func isPausedDay(pauses []CheckInPause, day time.Time) bool {
+	for i := range pauses {
+		if pauses[i].CoversDay(day) {
+			return true
+		}
+	}
+	return false
+}
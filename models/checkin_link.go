@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// CheckInLinkUse 一键签到链接的使用记录，Nonce唯一以保证链接只能使用一次
+type CheckInLinkUse struct {
+	ID     uint      `json:"id" gorm:"primaryKey"`
+	UserID uint      `json:"user_id" gorm:"not null;index"`
+	Nonce  string    `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Day    string    `json:"day" gorm:"size:10;not null"`
+	UsedAt time.Time `json:"used_at"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDayBounds(t *testing.T) {
+	newYork := loadLocation(t, "America/New_York")
+	santiago := loadLocation(t, "America/Santiago")
+
+	tests := []struct {
+		name      string
+		t         time.Time
+		loc       *time.Location
+		wantStart string
+		wantEnd   string
+	}{
+		{"UTC", time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC), time.UTC, "2026-01-05T00:00:00Z", "2026-01-06T00:00:00Z"},
+		{"converted to user time zone", time.Date(2026, 1, 6, 3, 0, 0, 0, time.UTC), newYork, "2026-01-05T00:00:00-05:00", "2026-01-06T00:00:00-05:00"},
+		{"23-hour day", time.Date(2026, 3, 8, 12, 0, 0, 0, newYork), newYork, "2026-03-08T00:00:00-05:00", "2026-03-09T00:00:00-04:00"},
+		{"25-hour day", time.Date(2026, 11, 1, 12, 0, 0, 0, newYork), newYork, "2026-11-01T00:00:00-04:00", "2026-11-02T00:00:00-05:00"},
+		{"skipped midnight starts at 01:00", time.Date(2026, 9, 6, 12, 0, 0, 0, santiago), santiago, "2026-09-06T01:00:00-03:00", "2026-09-07T00:00:00-03:00"},
+		{"day before skipped midnight", time.Date(2026, 9, 5, 12, 0, 0, 0, santiago), santiago, "2026-09-05T00:00:00-04:00", "2026-09-06T01:00:00-03:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := DayBounds(tt.t, tt.loc)
+			if got := start.Format(time.RFC3339); got != tt.wantStart {
+				t.Errorf("start = %s, want %s", got, tt.wantStart)
+			}
+			if got := end.Format(time.RFC3339); got != tt.wantEnd {
+				t.Errorf("end = %s, want %s", got, tt.wantEnd)
+			}
+		})
+	}
+}
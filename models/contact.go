@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// EmergencyContact 紧急联系人，用户长时间未签到时会收到通知
+type EmergencyContact struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"user_id" gorm:"not null;index"`
+	Name         string    `json:"name" gorm:"size:100;not null"`
+	Email        string    `json:"email" gorm:"size:255;not null"`
+	Relationship string    `json:"relationship" gorm:"size:50"`
+	IsEnabled    bool      `json:"is_enabled" gorm:"default:true"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ContactNotification 紧急联系人通知记录
+// 同一次失联（以最后一次签到时间区分）的同一升级阶段只会通知每个联系人一次
+type ContactNotification struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"user_id" gorm:"not null;index"`
+	ContactID    uint      `json:"contact_id" gorm:"not null;uniqueIndex:idx_contact_silence_stage"`
+	SilenceSince time.Time `json:"silence_since" gorm:"not null;uniqueIndex:idx_contact_silence_stage"`
+	Stage        int       `json:"stage" gorm:"not null;default:0;uniqueIndex:idx_contact_silence_stage"`
+	SentAt       time.Time `json:"sent_at"`
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// 签到摘要邮件的频率
+const (
+	DigestCadenceNone    = ""        // 不发送摘要
+	DigestCadenceWeekly  = "weekly"  // 每周一汇总上一周（周一至周日）
+	DigestCadenceMonthly = "monthly" // 每月1日汇总上一个月
+)
+
+// IsValidDigestCadence 检查摘要频率是否受支持
+func IsValidDigestCadence(cadence string) bool {
+	return cadence == DigestCadenceNone || cadence == DigestCadenceWeekly || cadence == DigestCadenceMonthly
+}
+
+// DigestPeriod 返回now之前最近一个完整的摘要周期 [start, end)，按用户时区划分
+// key用于标识周期，避免重复发送，如 2024-W05、2024-01
+func DigestPeriod(cadence string, now time.Time, loc *time.Location) (start, end time.Time, key string) {
+	today, _ := DayBounds(now, loc)
+
+	if cadence == DigestCadenceMonthly {
+		end = LocalDay(today.Year(), today.Month(), 1, loc)
+		start = LocalDay(today.Year(), today.Month()-1, 1, loc)
+		return start, end, start.Format("2006-01")
+	}
+
+	// 本周一，time.Weekday以周日为0
+	offset := (int(today.Weekday()) + 6) % 7
+	end = LocalDay(today.Year(), today.Month(), today.Day()-offset, loc)
+	start = LocalDay(today.Year(), today.Month(), today.Day()-offset-7, loc)
+	year, week := start.ISOWeek()
+	return start, end, fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// DigestNote 摘要中列出的签到备注
+type DigestNote struct {
+	Date string `json:"date"`
+	Note string `json:"note"`
+}
+
+// DigestStats 一个摘要周期内的签到统计
+type DigestStats struct {
+	Days          int          // 统计的天数，不包括注册之前的日期
+	CheckedDays   int          // 签到的天数
+	MissedDays    int          // 未签到且不在暂停期间的天数
+	PausedDays    int          // 未签到但处于暂停期间的天数
+	LongestStreak int          // 周期内最长的连续签到天数，暂停的日期不中断连续记录
+	Notes         []DigestNote // 周期内带备注的签到，按时间顺序
+}
+
+// BuildDigestStats 统计 [start, end) 内的签到情况，since之前的日期（如注册前）不计入
+func BuildDigestStats(checkIns []CheckIn, pauses []CheckInPause, start, end, since time.Time, loc *time.Location) DigestStats {
+	checkedDays := make(map[string]bool, len(checkIns))
+	var stats DigestStats
+	for _, checkIn := range checkIns {
+		if checkIn.CheckInAt.Before(start) || !checkIn.CheckInAt.Before(end) {
+			continue
+		}
+		day := checkIn.CheckInAt.In(loc).Format("2006-01-02")
+		checkedDays[day] = true
+		if checkIn.Note != "" {
+			stats.Notes = append(stats.Notes, DigestNote{Date: day, Note: checkIn.Note})
+		}
+	}
+
+	firstDay, _ := DayBounds(since, loc)
+	streak := 0
+	for day := start.In(loc); day.Before(end); day = LocalDay(day.Year(), day.Month(), day.Day()+1, loc) {
+		if day.Before(firstDay) {
+			continue
+		}
+		stats.Days++
+
+		switch {
+		case checkedDays[day.Format("2006-01-02")]:
+			stats.CheckedDays++
+			streak++
+			if streak > stats.LongestStreak {
+				stats.LongestStreak = streak
+			}
+		case isPausedDay(pauses, day):
+			stats.PausedDays++
+		default:
+			stats.MissedDays++
+			streak = 0
+		}
+	}
+
+	return stats
+}
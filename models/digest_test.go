@@ -0,0 +1,238 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDigestPeriod(t *testing.T) {
+	newYork := loadLocation(t, "America/New_York")
+	santiago := loadLocation(t, "America/Santiago")
+
+	tests := []struct {
+		name      string
+		cadence   string
+		now       time.Time
+		loc       *time.Location
+		wantStart string
+		wantEnd   string
+		wantKey   string
+	}{
+		{
+			name:      "weekly mid-week",
+			cadence:   DigestCadenceWeekly,
+			now:       time.Date(2026, 1, 14, 12, 0, 0, 0, time.UTC),
+			loc:       time.UTC,
+			wantStart: "2026-01-05T00:00:00Z",
+			wantEnd:   "2026-01-12T00:00:00Z",
+			wantKey:   "2026-W02",
+		},
+		{
+			name:      "weekly on Monday",
+			cadence:   DigestCadenceWeekly,
+			now:       time.Date(2026, 1, 12, 0, 0, 0, 0, time.UTC),
+			loc:       time.UTC,
+			wantStart: "2026-01-05T00:00:00Z",
+			wantEnd:   "2026-01-12T00:00:00Z",
+			wantKey:   "2026-W02",
+		},
+		{
+			name:      "weekly across year end uses ISO week",
+			cadence:   DigestCadenceWeekly,
+			now:       time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+			loc:       time.UTC,
+			wantStart: "2025-12-22T00:00:00Z",
+			wantEnd:   "2025-12-29T00:00:00Z",
+			wantKey:   "2025-W52",
+		},
+		{
+			name:      "weekly uses user time zone",
+			cadence:   DigestCadenceWeekly,
+			now:       time.Date(2026, 1, 12, 2, 0, 0, 0, time.UTC), // 纽约仍是周日
+			loc:       newYork,
+			wantStart: "2025-12-29T00:00:00-05:00",
+			wantEnd:   "2026-01-05T00:00:00-05:00",
+			wantKey:   "2026-W01",
+		},
+		{
+			name:      "weekly across spring forward",
+			cadence:   DigestCadenceWeekly,
+			now:       time.Date(2026, 3, 10, 12, 0, 0, 0, newYork),
+			loc:       newYork,
+			wantStart: "2026-03-02T00:00:00-05:00",
+			wantEnd:   "2026-03-09T00:00:00-04:00",
+			wantKey:   "2026-W10",
+		},
+		{
+			name:      "weekly across fall back",
+			cadence:   DigestCadenceWeekly,
+			now:       time.Date(2026, 11, 2, 1, 0, 0, 0, newYork),
+			loc:       newYork,
+			wantStart: "2026-10-26T00:00:00-04:00",
+			wantEnd:   "2026-11-02T00:00:00-05:00",
+			wantKey:   "2026-W44",
+		},
+		{
+			name:      "weekly containing skipped midnight",
+			cadence:   DigestCadenceWeekly,
+			now:       time.Date(2026, 9, 8, 12, 0, 0, 0, santiago),
+			loc:       santiago,
+			wantStart: "2026-08-31T00:00:00-04:00",
+			wantEnd:   "2026-09-07T00:00:00-03:00",
+			wantKey:   "2026-W36",
+		},
+		{
+			name:      "monthly",
+			cadence:   DigestCadenceMonthly,
+			now:       time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC),
+			loc:       time.UTC,
+			wantStart: "2026-02-01T00:00:00Z",
+			wantEnd:   "2026-03-01T00:00:00Z",
+			wantKey:   "2026-02",
+		},
+		{
+			name:      "monthly in January",
+			cadence:   DigestCadenceMonthly,
+			now:       time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			loc:       time.UTC,
+			wantStart: "2025-12-01T00:00:00Z",
+			wantEnd:   "2026-01-01T00:00:00Z",
+			wantKey:   "2025-12",
+		},
+		{
+			name:      "monthly across DST change",
+			cadence:   DigestCadenceMonthly,
+			now:       time.Date(2026, 4, 1, 8, 0, 0, 0, newYork),
+			loc:       newYork,
+			wantStart: "2026-03-01T00:00:00-05:00",
+			wantEnd:   "2026-04-01T00:00:00-04:00",
+			wantKey:   "2026-03",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, key := DigestPeriod(tt.cadence, tt.now, tt.loc)
+			if got := start.Format(time.RFC3339); got != tt.wantStart {
+				t.Errorf("start = %s, want %s", got, tt.wantStart)
+			}
+			if got := end.Format(time.RFC3339); got != tt.wantEnd {
+				t.Errorf("end = %s, want %s", got, tt.wantEnd)
+			}
+			if key != tt.wantKey {
+				t.Errorf("key = %s, want %s", key, tt.wantKey)
+			}
+		})
+	}
+}
+
+// checkInsAt 按本地时间创建签到记录，note非空的记录带备注
+func checkInsAt(loc *time.Location, times ...string) []CheckIn {
+	var checkIns []CheckIn
+	for _, value := range times {
+		var note string
+		if len(value) > len("2006-01-02 15:04") {
+			value, note = value[:len("2006-01-02 15:04")], value[len("2006-01-02 15:04 "):]
+		}
+		at, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+		if err != nil {
+			panic(err)
+		}
+		checkIns = append(checkIns, CheckIn{CheckInAt: at, Note: note})
+	}
+	return checkIns
+}
+
+func TestBuildDigestStats(t *testing.T) {
+	newYork := loadLocation(t, "America/New_York")
+	santiago := loadLocation(t, "America/Santiago")
+
+	utcStart := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	utcEnd := utcStart.AddDate(0, 0, 7)
+	longAgo := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		checkIns []CheckIn
+		pauses   []CheckInPause
+		start    time.Time
+		end      time.Time
+		since    time.Time
+		loc      *time.Location
+		want     DigestStats
+	}{
+		{
+			name: "checked, paused and missed days",
+			checkIns: checkInsAt(time.UTC,
+				"2026-01-05 08:00", "2026-01-06 08:00", "2026-01-08 21:00 felt good", "2026-01-10 09:00",
+				"2026-01-04 23:59", "2026-01-12 00:00"), // 周期之外
+			pauses: []CheckInPause{{
+				StartAt: time.Date(2026, 1, 7, 0, 0, 0, 0, time.UTC),
+				EndAt:   time.Date(2026, 1, 8, 0, 0, 0, 0, time.UTC),
+			}},
+			start: utcStart, end: utcEnd, since: longAgo, loc: time.UTC,
+			want: DigestStats{
+				Days: 7, CheckedDays: 4, MissedDays: 2, PausedDays: 1, LongestStreak: 3,
+				Notes: []DigestNote{{Date: "2026-01-08", Note: "felt good"}},
+			},
+		},
+		{
+			name:     "days before registration are not counted",
+			checkIns: checkInsAt(time.UTC, "2026-01-08 10:00", "2026-01-09 10:00"),
+			start:    utcStart, end: utcEnd, since: time.Date(2026, 1, 7, 15, 0, 0, 0, time.UTC), loc: time.UTC,
+			want: DigestStats{Days: 5, CheckedDays: 2, MissedDays: 3, LongestStreak: 2},
+		},
+		{
+			name:     "check-ins grouped by user time zone",
+			checkIns: checkInsAt(time.UTC, "2026-01-06 03:00"), // 纽约1月5日22:00
+			start:    time.Date(2026, 1, 5, 0, 0, 0, 0, newYork), end: time.Date(2026, 1, 7, 0, 0, 0, 0, newYork),
+			since: longAgo, loc: newYork,
+			want: DigestStats{Days: 2, CheckedDays: 1, MissedDays: 1, LongestStreak: 1},
+		},
+		{
+			name: "week with spring forward",
+			checkIns: checkInsAt(newYork,
+				"2026-03-02 09:00", "2026-03-03 09:00", "2026-03-04 09:00", "2026-03-05 09:00",
+				"2026-03-06 09:00", "2026-03-07 09:00", "2026-03-08 23:30",
+				"2026-03-09 00:30"), // 周期之外
+			start: time.Date(2026, 3, 2, 0, 0, 0, 0, newYork), end: time.Date(2026, 3, 9, 0, 0, 0, 0, newYork),
+			since: longAgo, loc: newYork,
+			want: DigestStats{Days: 7, CheckedDays: 7, LongestStreak: 7},
+		},
+		{
+			name: "week with fall back",
+			checkIns: checkInsAt(newYork,
+				"2026-10-26 09:00", "2026-10-27 09:00", "2026-10-28 09:00", "2026-10-29 09:00",
+				"2026-10-30 09:00", "2026-10-31 09:00", "2026-11-01 23:30"),
+			start: time.Date(2026, 10, 26, 0, 0, 0, 0, newYork), end: time.Date(2026, 11, 2, 0, 0, 0, 0, newYork),
+			since: longAgo, loc: newYork,
+			want: DigestStats{Days: 7, CheckedDays: 7, LongestStreak: 7},
+		},
+		{
+			name: "week with skipped midnight",
+			checkIns: checkInsAt(santiago,
+				"2026-08-31 09:00", "2026-09-01 09:00", "2026-09-02 09:00", "2026-09-03 09:00",
+				"2026-09-04 09:00", "2026-09-05 09:00", "2026-09-06 09:00"),
+			start: LocalDay(2026, 8, 31, santiago), end: LocalDay(2026, 9, 7, santiago),
+			since: longAgo, loc: santiago,
+			want: DigestStats{Days: 7, CheckedDays: 7, LongestStreak: 7},
+		},
+		{
+			name:     "missed day after skipped midnight",
+			checkIns: checkInsAt(santiago, "2026-09-05 09:00", "2026-09-07 09:00"),
+			start:    LocalDay(2026, 9, 5, santiago), end: LocalDay(2026, 9, 8, santiago),
+			since: longAgo, loc: santiago,
+			want: DigestStats{Days: 3, CheckedDays: 2, MissedDays: 1, LongestStreak: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BuildDigestStats(tt.checkIns, tt.pauses, tt.start, tt.end, tt.since, tt.loc)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BuildDigestStats = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
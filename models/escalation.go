@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+)
+
+// 升级阶段的通知渠道
+const (
+	EscalationChannelEmail    = "email"    // 邮件提醒用户本人
+	EscalationChannelWebhook  = "webhook"  // 通过用户配置的webhook提醒用户本人
+	EscalationChannelContacts = "contacts" // 邮件通知紧急联系人
+)
+
+// 升级历史事件类型
+const (
+	EscalationEventFired  = "fired"  // 阶段已触发
+	EscalationEventFailed = "failed" // 阶段触发失败，下次检查时重试
+	EscalationEventReset  = "reset"  // 用户签到，升级流程重置
+)
+
+// EscalationStage 升级策略中的一个阶段
+// 用户失联（距最后一次签到）超过AfterHours小时后按Channel发送Template对应的邮件
+type EscalationStage struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     uint      `json:"user_id" gorm:"not null;index"`
+	Position   int       `json:"position" gorm:"not null"`
+	Name       string    `json:"name" gorm:"size:50"`
+	AfterHours int       `json:"after_hours" gorm:"not null"`
+	Channel    string    `json:"channel" gorm:"size:20;not null"`
+	Template   string    `json:"template" gorm:"size:50;not null"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// EscalationState 用户当前所处的升级进度
+type EscalationState struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"user_id" gorm:"not null;uniqueIndex"`
+	SilenceSince time.Time `json:"silence_since"`
+	LastPosition int       `json:"last_position"` // 本次失联中已触发的最后一个阶段，0表示尚未触发
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// EscalationEvent 升级阶段变化的历史记录，用于审计
+type EscalationEvent struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"user_id" gorm:"not null;index"`
+	Event        string    `json:"event" gorm:"size:20;not null"`
+	Position     int       `json:"position"`
+	Name         string    `json:"name" gorm:"size:50"`
+	Channel      string    `json:"channel" gorm:"size:20"`
+	Template     string    `json:"template" gorm:"size:50"`
+	SilenceSince time.Time `json:"silence_since"`
+	Detail       string    `json:"detail"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// DefaultEscalationStages 用户未配置策略时使用的默认升级策略
+func DefaultEscalationStages(userID uint) []EscalationStage {
+	return []EscalationStage{
+		{
+			UserID:     userID,
+			Position:   1,
+			Name:       "缺签警告",
+			AfterHours: 48,
+			Channel:    EscalationChannelEmail,
+			Template:   "missed_checkin_warning",
+		},
+		{
+			UserID:     userID,
+			Position:   2,
+			Name:       "通知紧急联系人",
+			AfterHours: 72,
+			Channel:    EscalationChannelContacts,
+			Template:   "emergency_contact_alert",
+		},
+	}
+}
+
+// IsValidEscalationChannel 检查升级渠道是否受支持
+func IsValidEscalationChannel(channel string) bool {
+	return channel == EscalationChannelEmail || channel == EscalationChannelWebhook || channel == EscalationChannelContacts
+}
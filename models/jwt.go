@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken JWT模式下的刷新令牌，只保存令牌的哈希值
+// 每次刷新都会换发新的刷新令牌，同一次登录换发的令牌属于同一个家族；
+// 已换发过的令牌被再次使用说明令牌可能已泄露，整个家族随之撤销
+type RefreshToken struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	UserID         uint       `json:"user_id" gorm:"not null;index"`
+	FamilyID       string     `json:"-" gorm:"size:32;not null;index"`
+	TokenHash      string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	SessionVersion int        `json:"-" gorm:"not null;default:0"` // 签发时用户的会话版本，修改或重置密码后令牌失效
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null;index"`
+	UsedAt         *time.Time `json:"used_at"` // 换发新令牌的时间，之后不能再使用
+	RevokedAt      *time.Time `json:"revoked_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// RevokedAccessToken 访问令牌吊销列表，登出后的访问令牌在过期前不能再使用
+// 令牌过期后记录即可清理
+type RevokedAccessToken struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	TokenID   string    `json:"token_id" gorm:"size:32;not null;uniqueIndex"` // 令牌的jti
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NormalizeLocale 规范化BCP 47语言标签，如 zh_cn → zh-CN、zh-hant-tw → zh-Hant-TW，无效时返回空字符串
+func NormalizeLocale(tag string) string {
+	tag = strings.TrimSpace(strings.ReplaceAll(tag, "_", "-"))
+	if tag == "" {
+		return ""
+	}
+
+	parts := strings.Split(tag, "-")
+	for i, part := range parts {
+		if len(part) == 0 || len(part) > 8 || !isAlphaNumeric(part) {
+			return ""
+		}
+		switch {
+		case i == 0:
+			// 主语言子标签为2-3个字母
+			if len(part) < 2 || len(part) > 3 || !isAlpha(part) {
+				return ""
+			}
+			parts[i] = strings.ToLower(part)
+		case len(part) == 4 && isAlpha(part):
+			// 文字子标签首字母大写，如 Hant
+			parts[i] = strings.ToUpper(part[:1]) + strings.ToLower(part[1:])
+		case len(part) == 2 && isAlpha(part):
+			// 地区子标签大写，如 CN
+			parts[i] = strings.ToUpper(part)
+		default:
+			parts[i] = strings.ToLower(part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// LocaleFallbacks 返回语言标签的回退链，如 zh-Hant-TW → [zh-Hant-TW zh-Hant zh]，不包含默认语言
+func LocaleFallbacks(locale string) []string {
+	locale = NormalizeLocale(locale)
+	if locale == "" {
+		return nil
+	}
+
+	chain := []string{locale}
+	for {
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			return chain
+		}
+		locale = locale[:i]
+		chain = append(chain, locale)
+	}
+}
+
+// ParseAcceptLanguage 从Accept-Language请求头中选出权重最高的语言，没有可用语言时返回空字符串
+func ParseAcceptLanguage(header string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := NormalizeLocale(fields[0])
+		if tag == "" {
+			// 忽略通配符和无效标签
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		tags = append(tags, weighted{tag: tag, q: q})
+	}
+
+	if len(tags) == 0 {
+		return ""
+	}
+
+	// 权重相同时保持请求头中的顺序
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+	return tags[0].tag
+}
+
+func isAlpha(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphaNumeric(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"time"
+)
+
+// 通知渠道类型
+const (
+	NotificationChannelEmail   = "email"   // 邮件，Target为空时发送到账户邮箱
+	NotificationChannelWebhook = "webhook" // 以签名的JSON POST到Target指定的URL，失败时重试
+)
+
+// 通知事件
+const (
+	NotificationEventReminder       = "reminder"        // 签到提醒
+	NotificationEventDeadlineMissed = "deadline_missed" // 错过签到截止时间
+	NotificationEventMissedWarning  = "missed_warning"  // 升级策略中通知用户本人的阶段
+	NotificationEventWelcome        = "welcome"         // 注册欢迎
+	NotificationEventVerification   = "verification"    // 邮箱验证，始终发送到账户邮箱
+	NotificationEventPasswordReset  = "password_reset"  // 找回密码，始终发送到账户邮箱
+	NotificationEventTest           = "test"            // 测试通知
+	NotificationEventContactAlert   = "contact_alert"   // 通知紧急联系人
+	NotificationEventVaultRelease   = "vault_release"   // 向收件人释放遗言消息
+	NotificationEventDigest         = "digest"          // 每周或每月的签到摘要
+
+	NotificationEventChannelVerification = "channel_verification" // 确认邮件渠道的收件地址，发送到渠道地址
+)
+
+// UserNotificationEvents 用户渠道可以订阅的事件
+var UserNotificationEvents = []string{
+	NotificationEventReminder,
+	NotificationEventDeadlineMissed,
+	NotificationEventMissedWarning,
+	NotificationEventWelcome,
+	NotificationEventTest,
+	NotificationEventDigest,
+}
+
+// UnsubscribableEvents 邮件中附带退订链接、可以一键退订的事件
+// 失联警告等安全相关的通知不能一键退订，只能通过通知渠道的订阅设置调整
+var UnsubscribableEvents = []string{
+	NotificationEventReminder,
+	NotificationEventDeadlineMissed,
+	NotificationEventDigest,
+}
+
+// NotificationChannel 用户配置的通知渠道
+// 事件会发送到所有订阅了它的启用渠道，没有任何渠道订阅时回退到账户邮箱
+// 邮件渠道的地址不是已验证的账户邮箱时，需要收件人点击确认邮件中的链接后才会收到通知
+type NotificationChannel struct {
+	ID                         uint      `json:"id" gorm:"primaryKey"`
+	UserID                     uint      `json:"user_id" gorm:"not null;index"`
+	Name                       string    `json:"name" gorm:"size:50"`
+	Type                       string    `json:"type" gorm:"size:20;not null"`
+	Target                     string    `json:"target" gorm:"size:500"`        // 邮箱地址或webhook URL
+	TargetVerified             bool      `json:"target_verified"`               // 邮件渠道的地址已确认
+	VerificationToken          string    `json:"-" gorm:"size:64;index"`        // 确认邮件中的令牌，确认后清空
+	VerificationTokenExpiresAt time.Time `json:"-"`                             // 确认令牌的过期时间
+	Secret                     string    `json:"-" gorm:"size:100"`             // webhook签名密钥，只在创建和轮换时返回
+	Events                     []string  `json:"events" gorm:"serializer:json"` // 订阅的事件，为空表示全部
+	IsEnabled                  bool      `json:"is_enabled" gorm:"default:true"`
+	CreatedAt                  time.Time `json:"created_at"`
+	UpdatedAt                  time.Time `json:"updated_at"`
+}
+
+// NeedsVerification 检查渠道是否为地址尚未确认的邮件渠道，这类渠道不会收到通知
+// 地址为空的邮件渠道发送到账户邮箱，不需要单独确认
+func (c *NotificationChannel) NeedsVerification() bool {
+	return c.Type == NotificationChannelEmail && c.Target != "" && !c.TargetVerified
+}
+
+// Accepts 检查渠道是否订阅了指定事件
+func (c *NotificationChannel) Accepts(event string) bool {
+	if len(c.Events) == 0 {
+		return true
+	}
+	for _, e := range c.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidNotificationChannel 检查通知渠道类型是否受支持
+func IsValidNotificationChannel(channel string) bool {
+	return channel == NotificationChannelEmail || channel == NotificationChannelWebhook
+}
+
+// IsUserNotificationEvent 检查事件是否可以被用户渠道订阅
+func IsUserNotificationEvent(event string) bool {
+	for _, e := range UserNotificationEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUnsubscribableEvent 检查事件是否可以通过退订链接关闭
+func IsUnsubscribableEvent(event string) bool {
+	for _, e := range UnsubscribableEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// EmailOptOut 用户通过退订链接关闭的邮件通知类别
+// 退订后该事件不再发送到邮件渠道，其他渠道不受影响
+type EmailOptOut struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_email_opt_outs_user_event"`
+	Event     string    `json:"event" gorm:"size:50;not null;uniqueIndex:idx_email_opt_outs_user_event"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// 发件箱邮件状态
+const (
+	EmailStatusPending = "pending" // 等待发送或重试
+	EmailStatusSent    = "sent"    // 已发送
+	EmailStatusDead    = "dead"    // 重试次数用尽，进入死信状态，可手动重发
+)
+
+// EmailOutbox 发件箱中的一封邮件
+// 邮件在入队时渲染，由后台任务发送，失败时按指数退避重试
+type EmailOutbox struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	UserID         uint       `json:"user_id" gorm:"not null;index"`
+	Event          string     `json:"event" gorm:"size:50"`
+	Template       string     `json:"template" gorm:"size:100"`
+	Locale         string     `json:"locale" gorm:"size:35"` // 渲染时请求的语言
+	To             string     `json:"to" gorm:"size:255;not null"`
+	Subject        string     `json:"subject" gorm:"size:500"`
+	Body           string     `json:"body,omitempty" gorm:"type:text"`            // 纯文本正文
+	HTMLBody       string     `json:"html_body,omitempty" gorm:"type:text"`       // HTML正文，模板未提供时为空
+	Sensitive      bool       `json:"sensitive" gorm:"default:false"`             // 正文敏感（如遗言消息），发送成功或进入死信后清除且不在接口中返回
+	UnsubscribeURL string     `json:"unsubscribe_url,omitempty" gorm:"size:1000"` // 退订链接，发送时写入List-Unsubscribe头
+	Status         string     `json:"status" gorm:"size:20;not null;index:idx_email_outboxes_due"`
+	Attempts       int        `json:"attempts"`
+	MaxAttempts    int        `json:"max_attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index:idx_email_outboxes_due"`
+	LastError      string     `json:"last_error" gorm:"size:500"`
+	SentAt         *time.Time `json:"sent_at"`
+	ResendOf       uint       `json:"resend_of,omitempty"` // 手动重发时指向原邮件
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+)
+
+// MaxPauseDuration 单次暂停的最长时间，未自动恢复的暂停在此之后同样恢复发送提醒
+const MaxPauseDuration = 90 * 24 * time.Hour
+
+// CheckInPause 暂停（休假）时段，期间不发送提醒、不触发升级策略，也不中断连续签到
+// 暂停总是在EndAt（或提前手动恢复时）结束；AutoResume为false时只有提醒保持静默，
+// 直到用户手动恢复，最长不超过MaxPauseDuration
+type CheckInPause struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	StartAt    time.Time  `json:"start_at" gorm:"not null"`
+	EndAt      time.Time  `json:"end_at" gorm:"not null"`
+	Reason     string     `json:"reason" gorm:"size:200"`
+	AutoResume bool       `json:"auto_resume" gorm:"default:true"`
+	ResumedAt  *time.Time `json:"resumed_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// EndTime 暂停实际结束的时间，提前手动恢复时为恢复时间，否则为EndAt
+func (p *CheckInPause) EndTime() time.Time {
+	if p.ResumedAt != nil && p.ResumedAt.Before(p.EndAt) {
+		return *p.ResumedAt
+	}
+	return p.EndAt
+}
+
+// ActiveAt 检查暂停在指定时间是否生效
+func (p *CheckInPause) ActiveAt(t time.Time) bool {
+	return !t.Before(p.StartAt) && t.Before(p.EndTime())
+}
+
+// MutesRemindersAt 检查暂停在指定时间是否仍让提醒保持静默
+// 不自动恢复的暂停在结束后继续静默提醒，直到手动恢复或达到MaxPauseDuration
+func (p *CheckInPause) MutesRemindersAt(t time.Time) bool {
+	if p.ActiveAt(t) {
+		return true
+	}
+	if p.AutoResume || p.ResumedAt != nil || t.Before(p.StartAt) {
+		return false
+	}
+	return t.Before(p.StartAt.Add(MaxPauseDuration))
+}
+
+// CoversDay 检查暂停是否覆盖了某一天中的任意时刻
+func (p *CheckInPause) CoversDay(day time.Time) bool {
+	dayStart, dayEnd := DayBounds(day, day.Location())
+
+	if !p.StartAt.Before(dayEnd) {
+		return false
+	}
+	return p.EndTime().After(dayStart)
+}
+
+// ActivePause 返回在指定时间生效的暂停，没有时返回nil
+func ActivePause(pauses []CheckInPause, t time.Time) *CheckInPause {
+	for i := range pauses {
+		if pauses[i].ActiveAt(t) {
+			return &pauses[i]
+		}
+	}
+	return nil
+}
+
+// RemindersMuted 检查指定时间是否有暂停让提醒保持静默
+func RemindersMuted(pauses []CheckInPause, t time.Time) bool {
+	for i := range pauses {
+		if pauses[i].MutesRemindersAt(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,40 +1,81 @@
 package models
 
 import (
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/robfig/cron/v3"
 )
 
+// DefaultReminderTime 默认的每日提醒时间
+const DefaultReminderTime = "09:00"
+
+// 提醒渠道，对应用户配置的通知渠道类型
+const (
+	ReminderChannelEmail   = NotificationChannelEmail   // 通过邮件发送提醒
+	ReminderChannelWebhook = NotificationChannelWebhook // 通过用户配置的webhook发送提醒
+)
+
+// CheckInReminder 签到提醒，每个用户可以有多条独立的提醒
 type CheckInReminder struct {
 	ID                uint      `json:"id" gorm:"primaryKey"`
-	UserID            uint      `json:"user_id" gorm:"not null;uniqueIndex"`
+	UserID            uint      `json:"user_id" gorm:"not null;index:idx_check_in_reminders_owner"`
+	Name              string    `json:"name" gorm:"size:50"`
+	Channel           string    `json:"channel" gorm:"size:20;default:'email'"` // 提醒渠道
 	IsEnabled         bool      `json:"is_enabled" gorm:"default:true"`
-	ReminderFrequency string    `json:"reminder_frequency" gorm:"default:'daily'"` // daily, hourly, custom
-	ReminderInterval  int       `json:"reminder_interval" gorm:"default:24"`       // 小时数
+	ReminderFrequency string    `json:"reminder_frequency" gorm:"default:'daily'"`   // daily, hourly, custom
+	ReminderInterval  int       `json:"reminder_interval" gorm:"default:24"`         // 小时数
+	ReminderTime      string    `json:"reminder_time" gorm:"size:5;default:'09:00'"` // 每日提醒时间，HH:MM
+	CheckInDeadline   string    `json:"checkin_deadline" gorm:"size:5"`              // 每日签到截止时间，HH:MM，为空表示不设截止
+	LastDeadlineMiss  string    `json:"last_deadline_miss" gorm:"size:10"`           // 最近一次错过截止时间的日期
+	CronExpression    string    `json:"cron_expression" gorm:"size:200"`             // custom频率使用的cron表达式，多个表达式用分号分隔
 	NextReminder      time.Time `json:"next_reminder"`
 	LastReminder      time.Time `json:"last_reminder"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
 }
 
-// CalculateNextReminder 计算下次提醒时间
-func (r *CheckInReminder) CalculateNextReminder(lastCheckIn time.Time) time.Time {
+// CalculateNextReminder 计算下次提醒时间，每日提醒按用户时区的ReminderTime计算
+// 签到周期为用户时区的自然日，当前周期内已经签到时推迟到下一个周期的第一次提醒
+func (r *CheckInReminder) CalculateNextReminder(lastCheckIn time.Time, loc *time.Location) time.Time {
 	if !r.IsEnabled {
 		return time.Time{}
 	}
 
+	now := time.Now().In(loc)
+	dayStart, dayEnd := DayBounds(now, loc)
+	if !lastCheckIn.IsZero() && !lastCheckIn.Before(dayStart) {
+		return r.firstReminderOfPeriod(dayEnd, loc)
+	}
+
+	return r.nextReminderAfter(now, lastCheckIn, loc)
+}
+
+// firstReminderOfPeriod 计算从periodStart开始的签到周期内的第一次提醒时间
+func (r *CheckInReminder) firstReminderOfPeriod(periodStart time.Time, loc *time.Location) time.Time {
+	switch r.ReminderFrequency {
+	case "daily", "hourly":
+		return r.reminderClockOn(periodStart, loc)
+	default:
+		return r.nextReminderAfter(periodStart, time.Time{}, loc)
+	}
+}
+
+// nextReminderAfter 按提醒频率计算from之后的下一次提醒时间
+func (r *CheckInReminder) nextReminderAfter(from, lastCheckIn time.Time, loc *time.Location) time.Time {
 	switch r.ReminderFrequency {
 	case "daily":
 		// 每天提醒一次
-		now := time.Now()
-		next := time.Date(now.Year(), now.Month(), now.Day(), 9, 0, 0, 0, now.Location())
-		if next.Before(now) {
+		next := r.reminderClockOn(from, loc)
+		if next.Before(from) {
 			next = next.AddDate(0, 0, 1)
 		}
 		return next
 	case "hourly":
 		// 按小时间隔提醒
 		// 优先使用最后一次提醒时间作为基准，如果没有则使用最后签到时间，如果都没有则使用当前时间
-		baseTime := time.Now()
+		baseTime := from
 		if !r.LastReminder.IsZero() {
 			baseTime = r.LastReminder
 		} else if !lastCheckIn.IsZero() {
@@ -42,7 +83,203 @@ func (r *CheckInReminder) CalculateNextReminder(lastCheckIn time.Time) time.Time
 		}
 		return baseTime.Add(time.Duration(r.ReminderInterval) * time.Hour)
 	default:
-		// 自定义间隔
-		return time.Now().Add(time.Duration(r.ReminderInterval) * time.Hour)
+		// 自定义cron表达式，按用户时区计算
+		if r.CronExpression != "" {
+			if times, err := NextCronTimes(r.CronExpression, from.In(loc), 1); err == nil {
+				return times[0]
+			}
+		}
+		// 未设置表达式时按自定义间隔
+		return from.Add(time.Duration(r.ReminderInterval) * time.Hour)
+	}
+}
+
+// reminderClockOn 返回day当天（用户时区）的ReminderTime时刻
+func (r *CheckInReminder) reminderClockOn(day time.Time, loc *time.Location) time.Time {
+	hour, minute, err := ParseClock(r.ReminderTime)
+	if err != nil {
+		hour, minute, _ = ParseClock(DefaultReminderTime)
+	}
+	local := day.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, loc)
+}
+
+// DefaultReminder 新用户的默认提醒：每天09:00邮件提醒
+func DefaultReminder(userID uint) CheckInReminder {
+	return CheckInReminder{
+		UserID:            userID,
+		Name:              "每日提醒",
+		Channel:           ReminderChannelEmail,
+		IsEnabled:         true,
+		ReminderFrequency: "daily",
+		ReminderInterval:  24,
+		ReminderTime:      DefaultReminderTime,
+		NextReminder:      time.Now().AddDate(0, 0, 1),
+	}
+}
+
+// IsValidReminderFrequency 检查提醒频率是否受支持
+func IsValidReminderFrequency(frequency string) bool {
+	switch frequency {
+	case "daily", "hourly", "custom":
+		return true
+	}
+	return false
+}
+
+// IsValidReminderChannel 检查提醒渠道是否受支持
+func IsValidReminderChannel(channel string) bool {
+	return IsValidNotificationChannel(channel)
+}
+
+// DeadlineOn 返回指定日期（用户时区）的签到截止时间，未设置截止时间时第二个返回值为false
+func (r *CheckInReminder) DeadlineOn(day time.Time, loc *time.Location) (time.Time, bool) {
+	if r.CheckInDeadline == "" {
+		return time.Time{}, false
+	}
+
+	hour, minute, err := ParseClock(r.CheckInDeadline)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	local := day.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, loc), true
+}
+
+// ParseClock 解析HH:MM格式的时刻
+func ParseClock(clock string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// cronParser 自定义提醒使用的标准五段式cron解析器，同时支持@daily等描述符
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ParseCronExpression 解析用分号分隔的一个或多个cron表达式
+// 例如 "30 8 * * 1-5; 0 20 * * 1-5" 表示工作日8:30和20:00
+func ParseCronExpression(expression string) ([]cron.Schedule, error) {
+	var schedules []cron.Schedule
+	for _, spec := range strings.Split(expression, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		schedule, err := cronParser.Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %v", spec, err)
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	if len(schedules) == 0 {
+		return nil, fmt.Errorf("cron expression is empty")
+	}
+
+	return schedules, nil
+}
+
+// NextCronTimes 计算cron表达式在from之后的n次触发时间，按from所在时区的本地时间匹配
+// 夏令时开始时被跳过的本地时间顺延到跳变之后（如2:30变为3:30），结束时重复的本地时间只在第一次出现时触发
+func NextCronTimes(expression string, from time.Time, n int) ([]time.Time, error) {
+	schedules, err := ParseCronExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	// 在没有夏令时的UTC中按本地时间的字面值计算，再换算回本地时区
+	loc := from.Location()
+	wall := time.Date(from.Year(), from.Month(), from.Day(), from.Hour(), from.Minute(), from.Second(), from.Nanosecond(), time.UTC)
+
+	times := make([]time.Time, 0, n)
+	last := from
+	for len(times) < n {
+		var next time.Time
+		for _, schedule := range schedules {
+			candidate := schedule.Next(wall)
+			if candidate.IsZero() {
+				continue
+			}
+			if next.IsZero() || candidate.Before(next) {
+				next = candidate
+			}
+		}
+
+		if next.IsZero() {
+			break
+		}
+		wall = next
+
+		// 顺延后的时刻可能与跳变后的下一次触发相同，重复时间的第一次出现可能早于from
+		t := wallTime(next, loc)
+		if !t.After(last) {
+			continue
+		}
+		times = append(times, t)
+		last = t
+	}
+
+	if len(times) == 0 {
+		return nil, fmt.Errorf("cron expression never fires")
+	}
+
+	return times, nil
+}
+
+// MinCronSpacing custom频率相邻两次提醒的最短间隔，与reminder_interval的下限一致
+const MinCronSpacing = time.Hour
+
+// CheckCronSpacing 检查cron表达式在from之后一年内相邻两次触发的间隔都不小于MinCronSpacing
+// 按UTC计算，夏令时调整造成的间隔变化不计入；表达式从不触发时同样返回错误
+func CheckCronSpacing(expression string, from time.Time) error {
+	const batch = 48
+
+	from = from.UTC()
+	until := from.AddDate(1, 0, 0)
+	var last time.Time
+	for from.Before(until) {
+		times, err := NextCronTimes(expression, from, batch)
+		if err != nil {
+			if last.IsZero() {
+				return err
+			}
+			return nil
+		}
+
+		for _, t := range times {
+			if !last.IsZero() && t.Sub(last) < MinCronSpacing {
+				return fmt.Errorf("cron expression fires at %s and %s (UTC), reminders must be at least 1 hour apart",
+					last.Format("2006-01-02 15:04"), t.Format("15:04"))
+			}
+			last = t
+		}
+
+		if len(times) < batch {
+			return nil
+		}
+		from = last
+	}
+
+	return nil
+}
+
+// wallTime 将以UTC表示的本地时间字面值换算为loc中的时刻
+// 被夏令时跳过的本地时间顺延跳变的时长，重复的本地时间取第一次出现的时刻
+func wallTime(wall time.Time, loc *time.Location) time.Time {
+	t := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), loc)
+
+	// 按跳变前的偏移再换算一次：跳过的时间得到跳变后的对应时刻，重复的时间得到第一次出现的时刻
+	_, offset := t.Add(-12 * time.Hour).Zone()
+	early := wall.Add(-time.Duration(offset) * time.Second).In(loc)
+	if early.Hour() == wall.Hour() && early.Minute() == wall.Minute() && early.Before(t) {
+		return early
+	}
+	if t.Hour() != wall.Hour() || t.Minute() != wall.Minute() {
+		return early
 	}
+	return t
 }
@@ -0,0 +1,203 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronExpression(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		want       int
+		wantErr    bool
+	}{
+		{"single expression", "30 8 * * 1-5", 1, false},
+		{"multiple expressions", "30 8 * * 1-5; 0 20 * * 1-5", 2, false},
+		{"trailing separator", "0 9 * * *;", 1, false},
+		{"descriptor", "@daily", 1, false},
+		{"empty", "", 0, true},
+		{"only separators", " ; ;", 0, true},
+		{"six fields", "0 30 8 * * *", 0, true},
+		{"out of range", "0 25 * * *", 0, true},
+		{"one invalid part", "0 9 * * *; nonsense", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedules, err := ParseCronExpression(tt.expression)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseCronExpression(%q) error = nil, want error", tt.expression)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCronExpression(%q) error = %v", tt.expression, err)
+			}
+			if len(schedules) != tt.want {
+				t.Errorf("ParseCronExpression(%q) returned %d schedules, want %d", tt.expression, len(schedules), tt.want)
+			}
+		})
+	}
+}
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s unavailable: %v", name, err)
+	}
+	return loc
+}
+
+func TestNextCronTimes(t *testing.T) {
+	newYork := loadLocation(t, "America/New_York")
+	lordHowe := loadLocation(t, "Australia/Lord_Howe")
+
+	tests := []struct {
+		name       string
+		expression string
+		from       time.Time
+		n          int
+		want       []string
+	}{
+		{
+			name:       "daily in UTC",
+			expression: "30 8 * * *",
+			from:       time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC),
+			n:          2,
+			want:       []string{"2026-01-02T08:30:00Z", "2026-01-03T08:30:00Z"},
+		},
+		{
+			name:       "multiple expressions merged in order",
+			expression: "0 20 * * *; 30 8 * * *",
+			from:       time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			n:          3,
+			want:       []string{"2026-01-01T08:30:00Z", "2026-01-01T20:00:00Z", "2026-01-02T08:30:00Z"},
+		},
+		{
+			name:       "weekdays only",
+			expression: "0 9 * * 1-5",
+			from:       time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC), // 周五
+			n:          1,
+			want:       []string{"2026-01-05T09:00:00Z"},
+		},
+		{
+			name:       "local time in New York",
+			expression: "0 9 * * *",
+			from:       time.Date(2026, 1, 1, 0, 0, 0, 0, newYork),
+			n:          1,
+			want:       []string{"2026-01-01T09:00:00-05:00"},
+		},
+		{
+			name:       "skipped local time moves forward at spring forward",
+			expression: "30 2 * * *",
+			from:       time.Date(2026, 3, 7, 3, 0, 0, 0, newYork),
+			n:          3,
+			want:       []string{"2026-03-08T03:30:00-04:00", "2026-03-09T02:30:00-04:00", "2026-03-10T02:30:00-04:00"},
+		},
+		{
+			name:       "hourly across spring forward",
+			expression: "0 * * * *",
+			from:       time.Date(2026, 3, 8, 0, 30, 0, 0, newYork),
+			n:          3,
+			want:       []string{"2026-03-08T01:00:00-05:00", "2026-03-08T03:00:00-04:00", "2026-03-08T04:00:00-04:00"},
+		},
+		{
+			name:       "repeated local time fires once at fall back",
+			expression: "30 1 * * *",
+			from:       time.Date(2026, 10, 31, 2, 0, 0, 0, newYork),
+			n:          2,
+			want:       []string{"2026-11-01T01:30:00-04:00", "2026-11-02T01:30:00-05:00"},
+		},
+		{
+			name:       "hourly across fall back",
+			expression: "0 * * * *",
+			from:       time.Date(2026, 11, 1, 0, 30, 0, 0, newYork),
+			n:          3,
+			want:       []string{"2026-11-01T01:00:00-04:00", "2026-11-01T02:00:00-05:00", "2026-11-01T03:00:00-05:00"},
+		},
+		{
+			name:       "half-hour shift skipped time",
+			expression: "15 2 * * *",
+			from:       time.Date(2026, 10, 3, 3, 0, 0, 0, lordHowe),
+			n:          2,
+			want:       []string{"2026-10-04T02:45:00+11:00", "2026-10-05T02:15:00+11:00"},
+		},
+		{
+			name:       "half-hour shift repeated time",
+			expression: "45 1 * * *",
+			from:       time.Date(2026, 4, 4, 3, 0, 0, 0, lordHowe),
+			n:          2,
+			want:       []string{"2026-04-05T01:45:00+11:00", "2026-04-06T01:45:00+10:30"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			times, err := NextCronTimes(tt.expression, tt.from, tt.n)
+			if err != nil {
+				t.Fatalf("NextCronTimes error = %v", err)
+			}
+
+			got := make([]string, len(times))
+			for i, next := range times {
+				got[i] = next.Format(time.RFC3339)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("NextCronTimes = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("NextCronTimes = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestNextCronTimesNeverFires(t *testing.T) {
+	if _, err := NextCronTimes("0 0 30 2 *", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), 1); err == nil {
+		t.Error("NextCronTimes for February 30 error = nil, want error")
+	}
+}
+
+func TestCheckCronSpacing(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		expression string
+		wantErr    bool
+	}{
+		{"hourly", "0 * * * *", false},
+		{"hourly descriptor", "@hourly", false},
+		{"daily", "30 8 * * *", false},
+		{"twice on weekdays", "30 8 * * 1-5; 0 20 * * 1-5", false},
+		{"every two hours", "15 */2 * * *", false},
+		{"exactly one hour apart", "0 9 * * *; 0 10 * * *", false},
+		{"across DST changes", "30 1 * * *; 0 3 * * *", false},
+		{"every minute", "* * * * *", true},
+		{"every 30 minutes", "*/30 * * * *", true},
+		{"two expressions close together", "0 9 * * *; 30 9 * * *", true},
+		{"close together once a week", "0 9 * * 1; 59 9 * * 1", true},
+		{"close together once a year", "0,30 9 1 6 *", true},
+		{"across midnight", "50 23 * * *; 10 0 * * *", true},
+		{"never fires", "0 0 30 2 *", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckCronSpacing(tt.expression, from)
+			if tt.wantErr && err == nil {
+				t.Errorf("CheckCronSpacing(%q) error = nil, want error", tt.expression)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("CheckCronSpacing(%q) error = %v", tt.expression, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// RecoveryCode 两步验证的一次性恢复码，丢失验证器时代替动态码使用，只保存哈希值
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// NormalizeRecoveryCode 统一恢复码格式，忽略大小写、空格和连字符
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -15,17 +15,28 @@ type User struct {
 	EmailVerified              bool           `json:"email_verified" gorm:"default:false"`
 	VerificationToken          string         `json:"-" gorm:"size:255"`
 	VerificationTokenExpiresAt time.Time      `json:"-"`
+	Timezone                   string         `json:"timezone" gorm:"size:64"`           // IANA时区名，为空时使用服务器时区
+	Locale                     string         `json:"locale" gorm:"size:35"`             // 邮件语言（BCP 47标签，如 zh-CN、en），为空时使用默认模板
+	DigestCadence              string         `json:"digest_cadence" gorm:"size:10"`     // 签到摘要邮件频率（weekly/monthly），为空表示不发送
+	LastDigestPeriod           string         `json:"-" gorm:"size:10"`                  // 最近一次发送摘要的周期标识
+	SessionVersion             int            `json:"-" gorm:"not null;default:0"`       // 会话版本，递增后之前登录的会话全部失效
+	TOTPSecret                 string         `json:"-" gorm:"size:255"`                 // 两步验证密钥，加密存储，开启前保存待确认的密钥
+	TOTPEnabled                bool           `json:"totp_enabled" gorm:"default:false"` // 是否已开启两步验证
+	TOTPLastStep               int64          `json:"-" gorm:"not null;default:0"`       // 最近一次使用的动态码时间步，防止同一动态码被重复使用
+	TOTPFailedAttempts         int            `json:"-" gorm:"not null;default:0"`       // 连续输错两步验证码的次数，次数过多时暂时锁定
+	TOTPLastFailedAt           time.Time      `json:"-"`
 	CreatedAt                  time.Time      `json:"created_at"`
 	UpdatedAt                  time.Time      `json:"updated_at"`
 	DeletedAt                  gorm.DeletedAt `json:"-" gorm:"index"`
 
-	CheckIns        []CheckIn       `json:"checkins,omitempty" gorm:"foreignKey:UserID"`
-	CheckInReminder CheckInReminder `json:"reminder,omitempty" gorm:"foreignKey:UserID"`
+	CheckIns         []CheckIn         `json:"checkins,omitempty" gorm:"foreignKey:UserID"`
+	CheckInReminders []CheckInReminder `json:"reminders,omitempty" gorm:"foreignKey:UserID"`
 }
 
-// BeforeCreate GORM钩子，在创建用户前加密密码
-func (u *User) BeforeCreate(tx *gorm.DB) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+// SetPassword 使用bcrypt加密并设置密码，调用方需要自行保存用户
+// 直接给Password赋值会以明文保存，修改密码必须通过此方法
+func (u *User) SetPassword(password string, cost int) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	if err != nil {
 		return err
 	}
@@ -33,12 +44,35 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// NeedsRehash 检查密码哈希是否需要按当前配置重新生成，如bcrypt代价已修改或不是bcrypt哈希
+func (u *User) NeedsRehash(cost int) bool {
+	current, err := bcrypt.Cost([]byte(u.Password))
+	return err != nil || current != cost
+}
+
 // CheckPassword 验证密码
 func (u *User) CheckPassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	return err == nil
 }
 
+// Location 返回用户所在时区
+func (u *User) Location() *time.Location {
+	return LoadLocation(u.Timezone)
+}
+
+// LoadLocation 解析IANA时区名，为空或无效时返回服务器时区
+func LoadLocation(name string) *time.Location {
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
 // ToSafeUser 返回不包含敏感信息的用户信息
 func (u *User) ToSafeUser() map[string]interface{} {
 	return map[string]interface{}{
@@ -46,6 +80,10 @@ func (u *User) ToSafeUser() map[string]interface{} {
 		"username":       u.Username,
 		"email":          u.Email,
 		"email_verified": u.EmailVerified,
+		"timezone":       u.Timezone,
+		"locale":         u.Locale,
+		"digest_cadence": u.DigestCadence,
+		"totp_enabled":   u.TOTPEnabled,
 		"created_at":     u.CreatedAt,
 	}
 }
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// 遗言消息状态
+const (
+	VaultStatusActive   = "active"   // 等待释放
+	VaultStatusRevoked  = "revoked"  // 已被用户撤销
+	VaultStatusReleased = "released" // 已发送给所有收件人
+)
+
+// VaultMessage 遗言消息，用户连续ReleaseAfterDays天未签到后发送给收件人
+// 正文使用AES-GCM加密存储
+type VaultMessage struct {
+	ID               uint             `json:"id" gorm:"primaryKey"`
+	UserID           uint             `json:"user_id" gorm:"not null;index"`
+	Title            string           `json:"title" gorm:"size:200;not null"`
+	EncryptedBody    string           `json:"-" gorm:"type:text;not null"`
+	ReleaseAfterDays int              `json:"release_after_days" gorm:"not null"`
+	Status           string           `json:"status" gorm:"size:20;not null;default:'active';index"`
+	ReleasedAt       *time.Time       `json:"released_at"`
+	RevokedAt        *time.Time       `json:"revoked_at"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+	Recipients       []VaultRecipient `json:"recipients" gorm:"foreignKey:MessageID"`
+}
+
+// VaultRecipient 遗言消息收件人，DeliveredAt不为空表示已送达，保证释放幂等
+// 邮件入队后记录OutboxID，发件箱发送成功时才写入DeliveredAt
+type VaultRecipient struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	MessageID   uint       `json:"message_id" gorm:"not null;index"`
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	Name        string     `json:"name" gorm:"size:100;not null"`
+	Email       string     `json:"email" gorm:"size:255;not null"`
+	OutboxID    uint       `json:"-" gorm:"index"` // 当前排队中的发件箱邮件，为0表示尚未入队
+	DeliveredAt *time.Time `json:"delivered_at"`
+}
+
+// VaultReleaseLog 遗言消息释放日志
+type VaultReleaseLog struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	MessageID   uint      `json:"message_id" gorm:"not null;index"`
+	UserID      uint      `json:"user_id" gorm:"not null;index"`
+	RecipientID uint      `json:"recipient_id"`
+	Event       string    `json:"event" gorm:"size:20;not null"` // queued, delivered, failed, released
+	Detail      string    `json:"detail"`
+	CreatedAt   time.Time `json:"created_at"`
+}
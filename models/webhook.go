@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+)
+
+// 出站webhook事件
+const (
+	WebhookEventCheckInCreated = "checkin.created" // 用户完成签到
+	WebhookEventReminderSent   = "reminder.sent"   // 向用户发送了签到提醒
+	WebhookEventCheckInMissed  = "checkin.missed"  // 错过签到截止时间或触发了升级阶段
+)
+
+// WebhookEvents 所有可订阅的出站webhook事件
+var WebhookEvents = []string{
+	WebhookEventCheckInCreated,
+	WebhookEventReminderSent,
+	WebhookEventCheckInMissed,
+}
+
+// 投递状态
+const (
+	WebhookDeliveryPending   = "pending"   // 等待投递或重试
+	WebhookDeliverySucceeded = "succeeded" // 已成功投递
+	WebhookDeliveryFailed    = "failed"    // 重试次数用尽，不再投递
+)
+
+// WebhookEndpoint 用户注册的出站webhook地址
+type WebhookEndpoint struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id" gorm:"not null;index"`
+	URL         string    `json:"url" gorm:"size:500;not null"`
+	Description string    `json:"description" gorm:"size:100"`
+	Secret      string    `json:"-" gorm:"size:100;not null"`    // 签名密钥，只在创建和轮换时返回
+	Events      []string  `json:"events" gorm:"serializer:json"` // 订阅的事件，为空表示全部
+	IsEnabled   bool      `json:"is_enabled" gorm:"default:true"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Accepts 检查端点是否订阅了指定事件
+func (e *WebhookEndpoint) Accepts(event string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, ev := range e.Events {
+		if ev == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery 一次webhook投递及其重试状态
+// 投递到webhook端点时EndpointID不为0，投递到webhook通知渠道时ChannelID不为0
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	EndpointID     uint       `json:"endpoint_id" gorm:"not null;index"`
+	ChannelID      uint       `json:"channel_id,omitempty" gorm:"index"`
+	UserID         uint       `json:"user_id" gorm:"not null;index"`
+	DeliveryID     string     `json:"delivery_id" gorm:"size:64;not null;uniqueIndex"`
+	Event          string     `json:"event" gorm:"size:50;not null"`
+	Payload        string     `json:"payload" gorm:"type:text"`
+	Status         string     `json:"status" gorm:"size:20;not null;index:idx_webhook_deliveries_due"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index:idx_webhook_deliveries_due"`
+	LastStatusCode int        `json:"last_status_code"`
+	LastError      string     `json:"last_error" gorm:"size:500"` // 粗略的失败原因，不包含连接错误细节
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// IsWebhookEvent 检查事件是否可以被订阅
+func IsWebhookEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"checkin-system/config"
+)
+
+var (
+	// ErrInvalidLinkToken 链接令牌格式错误或签名不正确
+	ErrInvalidLinkToken = errors.New("invalid link token")
+	// ErrExpiredLinkToken 链接令牌已过期
+	ErrExpiredLinkToken = errors.New("link token has expired")
+)
+
+// CheckInLinkClaims 一键签到链接令牌中携带的信息
+type CheckInLinkClaims struct {
+	UserID    uint
+	Day       string // 令牌适用的签到日，格式2006-01-02
+	ExpiresAt time.Time
+	Nonce     string
+}
+
+// CheckInLinkService 一键签到链接服务，生成并校验带签名的签到令牌
+type CheckInLinkService struct {
+	baseURL string
+	signer  tokenSigner
+}
+
+// NewCheckInLinkService 创建一键签到链接服务
+func NewCheckInLinkService(appConfig config.AppConfig) *CheckInLinkService {
+	return &CheckInLinkService{
+		baseURL: appConfig.BaseURL,
+		signer:  tokenSigner{purpose: "checkin", secret: []byte(appConfig.LinkSecret)},
+	}
+}
+
+// GenerateURL 生成用户在指定日期使用的一键签到链接，链接在当天结束时过期
+func (s *CheckInLinkService) GenerateURL(userID uint, day time.Time) (string, error) {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	dayStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	claims := CheckInLinkClaims{
+		UserID:    userID,
+		Day:       dayStart.Format("2006-01-02"),
+		ExpiresAt: dayStart.AddDate(0, 0, 1),
+		Nonce:     hex.EncodeToString(nonce),
+	}
+
+	return s.baseURL + "/api/checkin/link?token=" + url.QueryEscape(s.sign(claims)), nil
+}
+
+// Parse 校验令牌签名和有效期并返回其中的信息
+func (s *CheckInLinkService) Parse(token string) (*CheckInLinkClaims, error) {
+	fields, ok := s.signer.verify(token, 4)
+	if !ok {
+		return nil, ErrInvalidLinkToken
+	}
+
+	userID, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidLinkToken
+	}
+
+	expiresAt, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidLinkToken
+	}
+
+	claims := CheckInLinkClaims{
+		UserID:    uint(userID),
+		Day:       fields[1],
+		ExpiresAt: time.Unix(expiresAt, 0),
+		Nonce:     fields[3],
+	}
+
+	if time.Now().After(claims.ExpiresAt) {
+		return nil, ErrExpiredLinkToken
+	}
+
+	return &claims, nil
+}
+
+// sign 生成签到令牌
+func (s *CheckInLinkService) sign(claims CheckInLinkClaims) string {
+	return s.signer.sign(
+		strconv.FormatUint(uint64(claims.UserID), 10),
+		claims.Day,
+		strconv.FormatInt(claims.ExpiresAt.Unix(), 10),
+		claims.Nonce,
+	)
+}
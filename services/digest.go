@@ -0,0 +1,135 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"checkin-system/models"
+
+	"gorm.io/gorm"
+)
+
+// 签到摘要任务参数
+const (
+	digestBatchSize = 100                  // 每批处理的用户数，同一批用户的签到和暂停记录各用一次查询加载
+	digestSendHour  = 8                    // 周期结束后，用户时区早上8点之后才发送
+	digestLookback  = 366 * 24 * time.Hour // 计算当前连续签到天数时回看的范围
+)
+
+// checkDigests 为开启摘要的用户发送上一个周期的签到摘要
+// 每小时运行一次，每个用户在自己时区的周期结束后发送，LastDigestPeriod保证同一周期只发送一次
+func (s *SchedulerService) checkDigests() {
+	now := time.Now()
+
+	var users []models.User
+	err := s.db.Where("digest_cadence <> ?", models.DigestCadenceNone).
+		FindInBatches(&users, digestBatchSize, func(tx *gorm.DB, batch int) error {
+			s.sendDigestBatch(users, now)
+			return nil
+		}).Error
+	if err != nil {
+		log.Printf("Error fetching users for digest: %v", err)
+	}
+}
+
+// sendDigestBatch 处理一批用户，只为到期的用户加载签到数据
+func (s *SchedulerService) sendDigestBatch(users []models.User, now time.Time) {
+	type duePeriod struct {
+		user       *models.User
+		start, end time.Time
+		key        string
+	}
+
+	var due []duePeriod
+	var userIDs []uint
+	for i := range users {
+		user := &users[i]
+		loc := user.Location()
+		start, end, key := models.DigestPeriod(user.DigestCadence, now, loc)
+		if user.LastDigestPeriod == key || now.In(loc).Before(end.Add(digestSendHour*time.Hour)) {
+			continue
+		}
+		due = append(due, duePeriod{user: user, start: start, end: end, key: key})
+		userIDs = append(userIDs, user.ID)
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	var checkIns []models.CheckIn
+	if err := s.db.Where("user_id IN ? AND checkin_at >= ?", userIDs, now.Add(-digestLookback)).
+		Order("checkin_at ASC").Find(&checkIns).Error; err != nil {
+		log.Printf("Error fetching check-ins for digest: %v", err)
+		return
+	}
+	var pauses []models.CheckInPause
+	if err := s.db.Where("user_id IN ?", userIDs).Find(&pauses).Error; err != nil {
+		log.Printf("Error fetching pauses for digest: %v", err)
+		return
+	}
+
+	checkInsByUser := make(map[uint][]models.CheckIn, len(due))
+	for _, checkIn := range checkIns {
+		checkInsByUser[checkIn.UserID] = append(checkInsByUser[checkIn.UserID], checkIn)
+	}
+	pausesByUser := make(map[uint][]models.CheckInPause, len(due))
+	for _, pause := range pauses {
+		pausesByUser[pause.UserID] = append(pausesByUser[pause.UserID], pause)
+	}
+
+	for _, d := range due {
+		// 在事务中认领周期，摘要入队后才提交：多个实例同时运行时其他实例等待行锁后认领失败，
+		// 发送失败时回滚认领，下次检查重试
+		tx := s.db.Begin()
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND (last_digest_period IS NULL OR last_digest_period <> ?)", d.user.ID, d.key).
+			Update("last_digest_period", d.key)
+		if result.Error != nil || result.RowsAffected == 0 {
+			tx.Rollback()
+			continue
+		}
+
+		// 周期结束后才注册的用户没有可以汇总的内容
+		if d.user.CreatedAt.Before(d.end) {
+			if err := s.sendDigest(d.user, d.start, d.end, checkInsByUser[d.user.ID], pausesByUser[d.user.ID]); err != nil {
+				tx.Rollback()
+				log.Printf("Error sending %s digest to user %d: %v", d.user.DigestCadence, d.user.ID, err)
+				continue
+			}
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			log.Printf("Error claiming %s digest of user %d: %v", d.user.DigestCadence, d.user.ID, err)
+		}
+	}
+}
+
+// sendDigest 统计并发送一个用户的签到摘要
+func (s *SchedulerService) sendDigest(user *models.User, start, end time.Time, checkIns []models.CheckIn, pauses []models.CheckInPause) error {
+	loc := user.Location()
+	stats := models.BuildDigestStats(checkIns, pauses, start, end, user.CreatedAt, loc)
+	// 摘要只加载了最近一段时间的签到，当前连续签到需要单独计算
+	currentStreak, err := ConsecutiveDays(s.db, user.ID, pauses, loc)
+	if err != nil {
+		return err
+	}
+
+	return s.notifier.Dispatch(&Notification{
+		Event:    models.NotificationEventDigest,
+		User:     user,
+		Template: "checkin_digest",
+		Data: map[string]interface{}{
+			"Username":      user.Username,
+			"Cadence":       user.DigestCadence,
+			"PeriodStart":   start.Format("2006-01-02"),
+			"PeriodEnd":     end.AddDate(0, 0, -1).Format("2006-01-02"),
+			"Days":          stats.Days,
+			"CheckedDays":   stats.CheckedDays,
+			"MissedDays":    stats.MissedDays,
+			"PausedDays":    stats.PausedDays,
+			"LongestStreak": stats.LongestStreak,
+			"CurrentStreak": currentStreak,
+			"Notes":         stats.Notes,
+		},
+	})
+}
@@ -2,193 +2,301 @@ package services
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
-
+	htmltemplate "html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
 	"text/template"
 
 	"checkin-system/config"
 	"checkin-system/models"
 
 	"gopkg.in/gomail.v2"
+	"gorm.io/gorm"
 )
 
 // EmailService 邮件服务
 type EmailService struct {
+	db        *gorm.DB
 	config    config.EmailConfig
-	dialer    *gomail.Dialer
+	transport MailTransport
+	mu        sync.RWMutex // 保护templates和layouts，重新加载时整体替换
+	saveMu    sync.Mutex   // 串行化模板的保存
 	templates config.EmailTemplates
+	layouts   map[string]*htmltemplate.Template // 按语言标签索引的HTML邮件布局，默认布局的键为空字符串，加载失败时只发送纯文本
+	wake      chan struct{}                     // 有新邮件入队时唤醒发件箱任务
 }
 
 // NewEmailService 创建邮件服务实例
-func NewEmailService(emailConfig config.EmailConfig) *EmailService {
-	dialer := gomail.NewDialer(
-		emailConfig.SMTPHost,
-		587,
-		emailConfig.SMTPEmail,
-		emailConfig.SMTPPassword,
-	)
-
+func NewEmailService(db *gorm.DB, emailConfig config.EmailConfig) *EmailService {
 	templates, err := config.LoadEmailTemplates()
 	if err != nil {
 		fmt.Printf("Warning: Failed to load email templates: %v\n", err)
 		templates = make(config.EmailTemplates)
 	}
 
+	layouts, err := loadEmailLayouts()
+	if err != nil {
+		log.Printf("Warning: Failed to load email layout, HTML emails are disabled: %v", err)
+	}
+
 	return &EmailService{
+		db:        db,
 		config:    emailConfig,
-		dialer:    dialer,
+		transport: newMailTransport(emailConfig),
 		templates: templates,
+		layouts:   layouts,
+		wake:      make(chan struct{}, 1),
 	}
 }
 
-// SendWelcomeEmail 发送欢迎邮件
-func (e *EmailService) SendWelcomeEmail(user *models.User) error {
-	template, exists := e.templates["welcome"]
-	if !exists {
-		return fmt.Errorf("welcome email template not found")
-	}
+// RenderVaultMessage 渲染遗言消息邮件，用于发送和预览，使用留言用户的语言
+func (e *EmailService) RenderVaultMessage(recipient *models.VaultRecipient, user *models.User, title, message string) (*RenderedEmail, error) {
+	return e.RenderEmail("vault_release", user.Locale, VaultMessageData(recipient, user, title, message))
+}
 
-	subject, body, err := e.parseTemplate(template, map[string]interface{}{
-		"Username": user.Username,
-		"Email":    user.Email,
-	})
-	if err != nil {
-		return err
+// VaultMessageData 遗言消息模板变量
+func VaultMessageData(recipient *models.VaultRecipient, user *models.User, title, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"RecipientName": recipient.Name,
+		"Username":      user.Username,
+		"Email":         user.Email,
+		"Title":         title,
+		"Message":       message,
 	}
+}
 
-	return e.sendEmail(user.Email, subject, body)
+// RenderedEmail 渲染后的邮件内容
+type RenderedEmail struct {
+	Subject string
+	Body    string // 纯文本正文
+	HTML    string // HTML正文，模板未提供时为空
 }
 
-// SendDailyReminder 发送每日提醒邮件
-func (e *EmailService) SendDailyReminder(user *models.User) error {
-	template, exists := e.templates["daily_reminder"]
-	if !exists {
-		return fmt.Errorf("daily reminder email template not found")
-	}
+// RenderEmail 按收件人语言选择模板变体，渲染主题、纯文本正文和HTML正文
+func (e *EmailService) RenderEmail(templateKey, locale string, data map[string]interface{}) (*RenderedEmail, error) {
+	e.mu.RLock()
+	template, exists := e.templates[templateKey]
+	layout := e.layoutFor(locale)
+	e.mu.RUnlock()
 
-	subject, body, err := e.parseTemplate(template, map[string]interface{}{
-		"Username": user.Username,
-	})
-	if err != nil {
-		return err
+	if !exists {
+		return nil, fmt.Errorf("%s email template not found", templateKey)
 	}
 
-	return e.sendEmail(user.Email, subject, body)
+	variant, resolved := localizedTemplate(template, locale)
+	return e.parseTemplate(variant, layout, resolved, data)
 }
 
-// SendHourlyReminder 发送小时提醒邮件
-func (e *EmailService) SendHourlyReminder(user *models.User) error {
-	template, exists := e.templates["hourly_reminder"]
-	if !exists {
-		return fmt.Errorf("hourly reminder email template not found")
+// RenderTemplate 渲染指定模板，返回主题和纯文本正文
+func (e *EmailService) RenderTemplate(templateKey, locale string, data map[string]interface{}) (subject, body string, err error) {
+	rendered, err := e.RenderEmail(templateKey, locale, data)
+	if err != nil {
+		return "", "", err
 	}
+	return rendered.Subject, rendered.Body, nil
+}
 
-	subject, body, err := e.parseTemplate(template, map[string]interface{}{
-		"Username": user.Username,
-	})
+// parseTemplate 解析邮件模板
+func (e *EmailService) parseTemplate(emailTemplate config.EmailTemplate, layout *htmltemplate.Template, locale string, data map[string]interface{}) (*RenderedEmail, error) {
+	// 解析主题
+	subjectTmpl, err := template.New("subject").Parse(emailTemplate.Subject)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return e.sendEmail(user.Email, subject, body)
-}
-
-// SendMissedCheckInWarning 发送缺签警告邮件
-func (e *EmailService) SendMissedCheckInWarning(user *models.User) error {
-	template, exists := e.templates["missed_checkin_warning"]
-	if !exists {
-		return fmt.Errorf("missed checkin warning email template not found")
+	var subjectBuf bytes.Buffer
+	if err := subjectTmpl.Execute(&subjectBuf, data); err != nil {
+		return nil, err
 	}
 
-	subject, body, err := e.parseTemplate(template, map[string]interface{}{
-		"Username": user.Username,
-	})
+	// 解析正文
+	bodyTmpl, err := template.New("body").Parse(emailTemplate.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return e.sendEmail(user.Email, subject, body)
-}
+	var bodyBuf bytes.Buffer
+	if err := bodyTmpl.Execute(&bodyBuf, data); err != nil {
+		return nil, err
+	}
 
-// SendTestEmail 发送测试邮件
-func (e *EmailService) SendTestEmail(user *models.User) error {
-	template, exists := e.templates["test_email"]
-	if !exists {
-		return fmt.Errorf("test email template not found")
+	rendered := &RenderedEmail{
+		Subject: subjectBuf.String(),
+		Body:    bodyBuf.String(),
 	}
 
-	subject, body, err := e.parseTemplate(template, map[string]interface{}{
-		"Username": user.Username,
-	})
-	if err != nil {
-		return err
+	// 解析HTML正文，套用公共布局
+	if emailTemplate.HTML != "" && layout != nil {
+		html, err := renderHTML(layout, emailTemplate.HTML, rendered.Subject, locale, data)
+		if err != nil {
+			return nil, err
+		}
+		rendered.HTML = html
 	}
 
-	return e.sendEmail(user.Email, subject, body)
+	return rendered, nil
 }
 
-// SendEmailVerification 发送邮箱验证邮件
-func (e *EmailService) SendEmailVerification(user *models.User, verificationURL string) error {
-	template, exists := e.templates["email_verification"]
-	if !exists {
-		return fmt.Errorf("email verification template not found")
-	}
-
-	subject, body, err := e.parseTemplate(template, map[string]interface{}{
-		"Username":        user.Username,
-		"VerificationURL": verificationURL,
-	})
+// renderHTML 将HTML正文定义为content模板嵌入公共布局渲染，用户数据会被自动转义
+func renderHTML(layout *htmltemplate.Template, html, subject, locale string, data map[string]interface{}) (string, error) {
+	tmpl, err := layout.Clone()
 	if err != nil {
-		return err
+		return "", err
 	}
-
-	return e.sendEmail(user.Email, subject, body)
+	return executeHTML(tmpl, html, subject, locale, data)
 }
 
-// parseTemplate 解析邮件模板
-func (e *EmailService) parseTemplate(emailTemplate config.EmailTemplate, data map[string]interface{}) (subject, body string, err error) {
-	// 解析主题
-	subjectTmpl, err := template.New("subject").Parse(emailTemplate.Subject)
-	if err != nil {
-		return "", "", err
+// executeHTML 在布局副本上解析content模板并执行layout
+func executeHTML(tmpl *htmltemplate.Template, html, subject, locale string, data map[string]interface{}) (string, error) {
+	if _, err := tmpl.New("content").Parse(html); err != nil {
+		return "", err
 	}
 
-	var subjectBuf bytes.Buffer
-	if err := subjectTmpl.Execute(&subjectBuf, data); err != nil {
-		return "", "", err
+	// 布局中使用主题作为页面标题，语言作为页面的lang属性
+	layoutData := make(map[string]interface{}, len(data)+2)
+	for k, v := range data {
+		layoutData[k] = v
 	}
+	layoutData["Subject"] = subject
+	layoutData["Locale"] = locale
 
-	// 解析正文
-	bodyTmpl, err := template.New("body").Parse(emailTemplate.Body)
-	if err != nil {
-		return "", "", err
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "layout", layoutData); err != nil {
+		return "", err
 	}
+	return buf.String(), nil
+}
 
-	var bodyBuf bytes.Buffer
-	if err := bodyTmpl.Execute(&bodyBuf, data); err != nil {
-		return "", "", err
+// sendEmail 发送发件箱中的一封邮件，提供HTML正文时以multipart/alternative发送，纯文本作为备选
+// 带退订链接的邮件附加List-Unsubscribe和List-Unsubscribe-Post头，支持邮件客户端的一键退订（RFC 8058）
+func (e *EmailService) sendEmail(message *models.EmailOutbox) error {
+	m := gomail.NewMessage()
+	m.SetAddressHeader("From", e.config.FromAddress, e.config.FromName)
+	m.SetHeader("To", message.To)
+	m.SetHeader("Subject", message.Subject)
+	if message.UnsubscribeURL != "" {
+		m.SetHeader("List-Unsubscribe", "<"+message.UnsubscribeURL+">")
+		m.SetHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+	m.SetBody("text/plain", message.Body)
+	if message.HTMLBody != "" {
+		m.AddAlternative("text/html", message.HTMLBody)
 	}
 
-	return subjectBuf.String(), bodyBuf.String(), nil
+	return e.transport.Send(e.config.FromAddress, []string{message.To}, m)
 }
 
-// sendEmail 发送邮件
-func (e *EmailService) sendEmail(to, subject, body string) error {
-	m := gomail.NewMessage()
-	m.SetHeader("From", e.config.SMTPEmail)
-	m.SetHeader("To", to)
-	m.SetHeader("Subject", subject)
-	m.SetBody("text/plain", body)
+// Mailbox 返回保留已发送邮件的发送方式，smtp和stdout方式不保留邮件
+func (e *EmailService) Mailbox() (Mailbox, bool) {
+	mailbox, ok := e.transport.(Mailbox)
+	return mailbox, ok
+}
+
+// HasTemplate 检查邮件模板是否存在
+func (e *EmailService) HasTemplate(key string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 
-	return e.dialer.DialAndSend(m)
+	_, exists := e.templates[key]
+	return exists
 }
 
-// ReloadTemplates 重新加载邮件模板
+// ReloadTemplates 从磁盘重新加载邮件模板和HTML布局，任一加载失败时保留原有模板
 func (e *EmailService) ReloadTemplates() error {
 	templates, err := config.LoadEmailTemplates()
 	if err != nil {
 		return err
 	}
+
+	layouts, err := loadEmailLayouts()
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
 	e.templates = templates
+	e.layouts = layouts
+	e.mu.Unlock()
 	return nil
 }
+
+// localizedTemplate 按语言回退链选择模板变体，如 zh-TW → zh → 默认，同时返回选中变体的语言，默认模板为空字符串
+func localizedTemplate(emailTemplate config.EmailTemplate, locale string) (config.EmailTemplate, string) {
+	for _, candidate := range models.LocaleFallbacks(locale) {
+		for key, variant := range emailTemplate.Locales {
+			if models.NormalizeLocale(key) == candidate {
+				return variant, candidate
+			}
+		}
+	}
+	return emailTemplate, ""
+}
+
+// layoutFor 按语言回退链选择HTML布局，未加载布局时返回nil，调用方需持有读锁
+func (e *EmailService) layoutFor(locale string) *htmltemplate.Template {
+	for _, candidate := range models.LocaleFallbacks(locale) {
+		if layout, ok := e.layouts[candidate]; ok {
+			return layout
+		}
+	}
+	return e.layouts[""]
+}
+
+// emailTemplateFuncs HTML邮件模板中可用的函数
+var emailTemplateFuncs = htmltemplate.FuncMap{
+	// dict 将键值对组合为map，用于向局部模板传递多个参数
+	"dict": func(pairs ...interface{}) (map[string]interface{}, error) {
+		if len(pairs)%2 != 0 {
+			return nil, errors.New("dict requires key-value pairs")
+		}
+		m := make(map[string]interface{}, len(pairs)/2)
+		for i := 0; i < len(pairs); i += 2 {
+			key, ok := pairs[i].(string)
+			if !ok {
+				return nil, errors.New("dict keys must be strings")
+			}
+			m[key] = pairs[i+1]
+		}
+		return m, nil
+	},
+}
+
+// loadEmailLayouts 加载HTML邮件的公共布局和局部模板，布局必须定义layout模板
+// 语言子目录中的文件在默认布局的副本上解析，只需覆盖与默认布局不同的模板
+func loadEmailLayouts() (map[string]*htmltemplate.Template, error) {
+	base, err := htmltemplate.New("email").Funcs(emailTemplateFuncs).ParseGlob(filepath.Join(config.EmailLayoutDir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	if base.Lookup("layout") == nil {
+		return nil, errors.New(`email layout does not define "layout"`)
+	}
+
+	layouts := map[string]*htmltemplate.Template{"": base}
+
+	entries, err := os.ReadDir(config.EmailLayoutDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		locale := models.NormalizeLocale(entry.Name())
+		if !entry.IsDir() || locale == "" {
+			continue
+		}
+
+		layout, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := layout.ParseGlob(filepath.Join(config.EmailLayoutDir, entry.Name(), "*.html")); err != nil {
+			return nil, fmt.Errorf("%s layout: %w", entry.Name(), err)
+		}
+		layouts[locale] = layout
+	}
+
+	return layouts, nil
+}
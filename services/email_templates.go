@@ -0,0 +1,222 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+	"time"
+
+	"checkin-system/config"
+	"checkin-system/models"
+)
+
+// TemplateSampleData 预览和校验模板时使用的示例数据，覆盖所有模板用到的变量
+func TemplateSampleData() map[string]interface{} {
+	return map[string]interface{}{
+		"Username":        "zhangsan",
+		"Email":           "zhangsan@example.com",
+		"CheckInURL":      "https://checkin.example.com/api/checkin/link?token=sample",
+		"VerificationURL": "https://checkin.example.com/api/verify-email?token=sample",
+		"ResetURL":        "https://checkin.example.com/reset-password?token=sample",
+		"ExpiresIn":       60,
+		"SilentHours":     50,
+		"SilentDays":      3,
+		"LastCheckIn":     "2024-01-01 08:00",
+		"Deadline":        "21:00",
+		"ContactName":     "李四",
+		"RecipientName":   "李四",
+		"Title":           "写给你的信",
+		"Message":         "如果你收到这封信……\n\n这是示例正文。",
+		"UnsubscribeURL":  "https://checkin.example.com/api/unsubscribe?token=sample",
+		"Cadence":         "weekly",
+		"PeriodStart":     "2024-01-01",
+		"PeriodEnd":       "2024-01-07",
+		"Days":            7,
+		"CheckedDays":     5,
+		"MissedDays":      1,
+		"PausedDays":      1,
+		"LongestStreak":   4,
+		"CurrentStreak":   2,
+		"Notes":           []models.DigestNote{{Date: "2024-01-03", Note: "今天也没死"}},
+	}
+}
+
+// Templates 返回当前所有邮件模板的副本
+func (e *EmailService) Templates() config.EmailTemplates {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	templates := make(config.EmailTemplates, len(e.templates))
+	for key, tmpl := range e.templates {
+		templates[key] = tmpl
+	}
+	return templates
+}
+
+// Template 返回指定邮件模板
+func (e *EmailService) Template(key string) (config.EmailTemplate, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	tmpl, exists := e.templates[key]
+	return tmpl, exists
+}
+
+// SaveTemplate 校验并保存一个邮件模板（不存在时新建），写入文件后重新加载
+func (e *EmailService) SaveTemplate(key string, tmpl config.EmailTemplate) error {
+	if problems := e.ValidateTemplate(tmpl); len(problems) > 0 {
+		return fmt.Errorf("invalid template: %s", problems[0])
+	}
+
+	e.saveMu.Lock()
+	defer e.saveMu.Unlock()
+
+	templates := e.Templates()
+	templates[key] = tmpl
+	if err := config.SaveEmailTemplates(templates); err != nil {
+		return err
+	}
+	return e.ReloadTemplates()
+}
+
+// ValidateTemplate 使用示例数据试渲染模板的默认内容和所有语言变体，返回发现的问题
+// 引用了不存在的变量也会被视为错误
+func (e *EmailService) ValidateTemplate(tmpl config.EmailTemplate) []string {
+	var problems []string
+	problems = append(problems, e.validateVariant("default", tmpl, "")...)
+
+	locales := make([]string, 0, len(tmpl.Locales))
+	for key := range tmpl.Locales {
+		locales = append(locales, key)
+	}
+	sort.Strings(locales)
+
+	for _, key := range locales {
+		locale := models.NormalizeLocale(key)
+		if locale == "" {
+			problems = append(problems, fmt.Sprintf("%s: invalid locale", key))
+			continue
+		}
+		variant := tmpl.Locales[key]
+		if len(variant.Locales) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: nested locales are not supported", key))
+		}
+		problems = append(problems, e.validateVariant(key, variant, locale)...)
+	}
+	return problems
+}
+
+// validateVariant 校验一个语言变体的主题、纯文本正文和HTML正文
+func (e *EmailService) validateVariant(name string, tmpl config.EmailTemplate, locale string) []string {
+	var problems []string
+	data := TemplateSampleData()
+
+	if tmpl.Subject == "" {
+		problems = append(problems, name+": subject is required")
+	}
+	if tmpl.Body == "" {
+		problems = append(problems, name+": body is required")
+	}
+
+	var subject string
+	for field, text := range map[string]string{"subject": tmpl.Subject, "body": tmpl.Body} {
+		t, err := template.New(field).Option("missingkey=error").Parse(text)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s.%s: %v", name, field, err))
+			continue
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.%s: %v", name, field, err))
+			continue
+		}
+		if field == "subject" {
+			subject = buf.String()
+		}
+	}
+
+	if tmpl.HTML == "" {
+		return problems
+	}
+
+	e.mu.RLock()
+	layout := e.layoutFor(locale)
+	e.mu.RUnlock()
+
+	if layout == nil {
+		// 没有加载布局时只检查语法
+		if _, err := htmltemplate.New("content").Funcs(emailTemplateFuncs).Parse(tmpl.HTML); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.html: %v", name, err))
+		}
+		return problems
+	}
+
+	clone, err := layout.Clone()
+	if err != nil {
+		return append(problems, fmt.Sprintf("%s.html: %v", name, err))
+	}
+	if _, err := executeHTML(clone.Option("missingkey=error"), tmpl.HTML, subject, locale, data); err != nil {
+		problems = append(problems, fmt.Sprintf("%s.html: %v", name, err))
+	}
+	return problems
+}
+
+// PreviewTemplate 使用示例数据渲染模板，data中的值会覆盖示例数据，用于预览尚未保存的修改
+func (e *EmailService) PreviewTemplate(tmpl config.EmailTemplate, locale string, data map[string]interface{}) (*RenderedEmail, error) {
+	sample := TemplateSampleData()
+	for k, v := range data {
+		sample[k] = v
+	}
+
+	e.mu.RLock()
+	layout := e.layoutFor(locale)
+	e.mu.RUnlock()
+
+	variant, resolved := localizedTemplate(tmpl, locale)
+	return e.parseTemplate(variant, layout, resolved, sample)
+}
+
+// WatchTemplates 定期检查模板文件和HTML布局的修改时间，发生变化时自动重新加载
+// 重新加载失败（如文件正在编辑、JSON不完整）时保留原有模板，下次变化时再试
+func (e *EmailService) WatchTemplates(interval time.Duration) {
+	go func() {
+		last := templatesModTime()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			modTime := templatesModTime()
+			if !modTime.After(last) {
+				continue
+			}
+			last = modTime
+
+			if err := e.ReloadTemplates(); err != nil {
+				log.Printf("Error reloading email templates: %v", err)
+				continue
+			}
+			log.Println("Email templates reloaded")
+		}
+	}()
+}
+
+// templatesModTime 返回模板文件和布局文件中最新的修改时间
+func templatesModTime() time.Time {
+	var latest time.Time
+	if info, err := os.Stat(config.EmailTemplatesPath); err == nil {
+		latest = info.ModTime()
+	}
+
+	filepath.Walk(config.EmailLayoutDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest
+}
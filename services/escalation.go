@@ -0,0 +1,199 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"checkin-system/models"
+)
+
+// evaluateEscalation 评估用户的升级策略，依次触发已到期但尚未触发的阶段
+// 暂停期间不触发任何阶段
+func (s *SchedulerService) evaluateEscalation(user *models.User) {
+	pauses := s.userPauses(user.ID)
+	if models.ActivePause(pauses, time.Now()) != nil {
+		return
+	}
+
+	silenceSince, lastCheckIn := s.silenceStart(user, pauses)
+
+	state, err := s.loadEscalationState(user.ID, silenceSince)
+	if err != nil {
+		log.Printf("Error loading escalation state of user %d: %v", user.ID, err)
+		return
+	}
+
+	stages := s.escalationStages(user.ID)
+	silent := time.Since(silenceSince)
+
+	for _, stage := range stages {
+		if stage.Position <= state.LastPosition {
+			continue
+		}
+		if silent < time.Duration(stage.AfterHours)*time.Hour {
+			// 阶段按时间升序排列，后面的阶段也未到期
+			break
+		}
+
+		data := map[string]interface{}{
+			"Username":    user.Username,
+			"Email":       user.Email,
+			"SilentHours": int(silent.Hours()),
+			"SilentDays":  int(silent.Hours() / 24),
+			"LastCheckIn": lastCheckIn,
+		}
+
+		if err := s.fireEscalationStage(user, &stage, silenceSince, data); err != nil {
+			log.Printf("Error firing escalation stage %d of user %d: %v", stage.Position, user.ID, err)
+			if stage.Channel == models.EscalationChannelContacts {
+				// 通知紧急联系人失败时不推进进度，下次检查时重试，已通知过的联系人不会重复通知
+				s.recordEscalationEvent(user.ID, models.EscalationEventFailed, &stage, silenceSince, err.Error())
+				return
+			}
+
+			// 邮件或webhook阶段失败不能阻塞后面的阶段（尤其是通知紧急联系人），记录失败后继续
+			state.LastPosition = stage.Position
+			if err := s.db.Save(state).Error; err != nil {
+				log.Printf("Error updating escalation state of user %d: %v", user.ID, err)
+				return
+			}
+			s.recordEscalationEvent(user.ID, models.EscalationEventFailed, &stage, silenceSince, err.Error())
+			continue
+		}
+
+		state.LastPosition = stage.Position
+		if err := s.db.Save(state).Error; err != nil {
+			log.Printf("Error updating escalation state of user %d: %v", user.ID, err)
+			return
+		}
+
+		s.recordEscalationEvent(user.ID, models.EscalationEventFired, &stage, silenceSince, "")
+		s.webhooks.Emit(user.ID, models.WebhookEventCheckInMissed, map[string]interface{}{
+			"reason":        "escalation",
+			"stage":         stage.Position,
+			"stage_name":    stage.Name,
+			"channel":       stage.Channel,
+			"silence_since": silenceSince,
+			"silent_hours":  data["SilentHours"],
+		})
+		log.Printf("Fired escalation stage %d (%s) for user %s", stage.Position, stage.Channel, user.Username)
+	}
+}
+
+// fireEscalationStage 按阶段渠道发送通知
+func (s *SchedulerService) fireEscalationStage(user *models.User, stage *models.EscalationStage, silenceSince time.Time, data map[string]interface{}) error {
+	switch stage.Channel {
+	case models.EscalationChannelEmail, models.EscalationChannelWebhook:
+		return s.notifier.Dispatch(&Notification{
+			Event:    models.NotificationEventMissedWarning,
+			User:     user,
+			Template: stage.Template,
+			Data:     data,
+			Channel:  stage.Channel,
+		})
+	case models.EscalationChannelContacts:
+		return s.notifyEmergencyContacts(user, stage, silenceSince, data)
+	default:
+		return fmt.Errorf("unsupported escalation channel %q", stage.Channel)
+	}
+}
+
+// notifyEmergencyContacts 通知用户的所有紧急联系人，同一次失联的同一阶段每个联系人只通知一次
+func (s *SchedulerService) notifyEmergencyContacts(user *models.User, stage *models.EscalationStage, silenceSince time.Time, data map[string]interface{}) error {
+	var contacts []models.EmergencyContact
+	if err := s.db.Where("user_id = ? AND is_enabled = ?", user.ID, true).Find(&contacts).Error; err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, contact := range contacts {
+		var count int64
+		s.db.Model(&models.ContactNotification{}).
+			Where("contact_id = ? AND silence_since = ? AND stage = ?", contact.ID, silenceSince, stage.Position).
+			Count(&count)
+		if count > 0 {
+			continue
+		}
+
+		contactData := make(map[string]interface{}, len(data)+1)
+		for k, v := range data {
+			contactData[k] = v
+		}
+		contactData["ContactName"] = contact.Name
+
+		err := s.notifier.Dispatch(&Notification{
+			Event:    models.NotificationEventContactAlert,
+			User:     user,
+			Template: stage.Template,
+			Data:     contactData,
+			Target:   contact.Email,
+		})
+		if err != nil {
+			log.Printf("Error notifying emergency contact %d of user %d: %v", contact.ID, user.ID, err)
+			lastErr = err
+			continue
+		}
+
+		notification := models.ContactNotification{
+			UserID:       user.ID,
+			ContactID:    contact.ID,
+			SilenceSince: silenceSince,
+			Stage:        stage.Position,
+			SentAt:       time.Now(),
+		}
+		if err := s.db.Create(&notification).Error; err != nil {
+			log.Printf("Error recording notification for contact %d: %v", contact.ID, err)
+		}
+	}
+
+	return lastErr
+}
+
+// escalationStages 获取用户的升级策略，未配置时使用默认策略
+func (s *SchedulerService) escalationStages(userID uint) []models.EscalationStage {
+	var stages []models.EscalationStage
+	if err := s.db.Where("user_id = ?", userID).Order("position ASC").Find(&stages).Error; err != nil || len(stages) == 0 {
+		return models.DefaultEscalationStages(userID)
+	}
+	return stages
+}
+
+// loadEscalationState 获取用户的升级进度，失联起点变化（用户已签到）时重新开始
+func (s *SchedulerService) loadEscalationState(userID uint, silenceSince time.Time) (*models.EscalationState, error) {
+	var state models.EscalationState
+	if err := s.db.Where("user_id = ?", userID).First(&state).Error; err != nil {
+		state = models.EscalationState{
+			UserID:       userID,
+			SilenceSince: silenceSince,
+		}
+		return &state, s.db.Create(&state).Error
+	}
+
+	if !state.SilenceSince.Equal(silenceSince) {
+		state.SilenceSince = silenceSince
+		state.LastPosition = 0
+		if err := s.db.Save(&state).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &state, nil
+}
+
+// recordEscalationEvent 记录升级历史
+func (s *SchedulerService) recordEscalationEvent(userID uint, event string, stage *models.EscalationStage, silenceSince time.Time, detail string) {
+	record := models.EscalationEvent{
+		UserID:       userID,
+		Event:        event,
+		Position:     stage.Position,
+		Name:         stage.Name,
+		Channel:      stage.Channel,
+		Template:     stage.Template,
+		SilenceSince: silenceSince,
+		Detail:       detail,
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		log.Printf("Error recording escalation event of user %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"checkin-system/config"
+	"checkin-system/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// JWT令牌类型，防止把一种令牌当作另一种使用
+const (
+	jwtTypeAccess    = "access"
+	jwtTypeTwoFactor = "2fa"
+)
+
+// twoFactorTokenTTL 密码验证通过后提交两步验证码的时限，与session中等待两步验证的时限一致
+const twoFactorTokenTTL = 5 * time.Minute
+
+var (
+	// ErrInvalidAccessToken 访问令牌格式错误、签名不正确、已过期或已吊销
+	ErrInvalidAccessToken = errors.New("invalid or expired access token")
+	// ErrInvalidRefreshToken 刷新令牌不存在、已过期或已撤销
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused 已换发过的刷新令牌被再次使用，同一家族的令牌已全部撤销
+	ErrRefreshTokenReused = errors.New("refresh token has already been used, please login again")
+)
+
+// jwtHeader HS256令牌固定使用的头部
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// JWTClaims JWT载荷
+type JWTClaims struct {
+	Subject        string `json:"sub"` // 用户ID
+	Type           string `json:"typ"`
+	SessionVersion int    `json:"sv"`            // 签发时用户的会话版本，修改或重置密码后令牌失效
+	FamilyID       string `json:"sid,omitempty"` // 对应的刷新令牌家族，登出时一并撤销
+	ID             string `json:"jti"`
+	IssuedAt       int64  `json:"iat"`
+	ExpiresAt      int64  `json:"exp"`
+}
+
+// UserID 返回令牌所属的用户ID
+func (c *JWTClaims) UserID() uint {
+	id, _ := strconv.ParseUint(c.Subject, 10, 64)
+	return uint(id)
+}
+
+// TokenPair 登录或刷新时返回给客户端的令牌
+type TokenPair struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int    `json:"expires_in"` // 访问令牌的有效秒数
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresIn int    `json:"refresh_expires_in"` // 刷新令牌的有效秒数
+}
+
+// JWTService JWT认证服务，签发HS256访问令牌和可轮换的刷新令牌
+// 访问令牌有效期短，不查询数据库即可校验签名；刷新令牌保存哈希值，每次使用后换发新令牌
+type JWTService struct {
+	db         *gorm.DB
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// NewJWTService 创建JWT认证服务
+func NewJWTService(db *gorm.DB, cfg config.JWTConfig) *JWTService {
+	return &JWTService{
+		db:         db,
+		secret:     []byte(cfg.Secret),
+		accessTTL:  cfg.AccessTTL,
+		refreshTTL: cfg.RefreshTTL,
+	}
+}
+
+// IssueTokens 登录成功后签发访问令牌和新家族的刷新令牌
+func (s *JWTService) IssueTokens(user *models.User) (*TokenPair, error) {
+	familyID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(s.db, user, familyID)
+}
+
+// Refresh 使用刷新令牌换发新的令牌，旧的刷新令牌随之失效
+// 已换发过的刷新令牌被再次使用时撤销整个家族，持有令牌的各方都需要重新登录
+func (s *JWTService) Refresh(refreshToken string) (*TokenPair, error) {
+	var token models.RefreshToken
+	if err := s.db.Where("token_hash = ?", models.HashToken(refreshToken)).First(&token).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if token.UsedAt != nil {
+		return nil, s.reused(token.FamilyID)
+	}
+
+	var user models.User
+	if err := s.db.First(&user, token.UserID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if user.SessionVersion != token.SessionVersion {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	tx := s.db.Begin()
+
+	// 先认领旧令牌，并发使用同一个令牌时只有一个请求能成功
+	result := tx.Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", token.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		tx.Rollback()
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return nil, s.reused(token.FamilyID)
+	}
+
+	pair, err := s.issue(tx, &user, token.FamilyID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// VerifyAccessToken 校验访问令牌的签名、有效期和吊销列表
+// 会话版本由调用方与用户当前的版本比较
+func (s *JWTService) VerifyAccessToken(token string) (*JWTClaims, error) {
+	claims, err := s.parse(token, jwtTypeAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	var revoked int64
+	if err := s.db.Model(&models.RevokedAccessToken{}).Where("token_id = ?", claims.ID).Count(&revoked).Error; err != nil {
+		return nil, err
+	}
+	if revoked > 0 {
+		return nil, ErrInvalidAccessToken
+	}
+	return claims, nil
+}
+
+// Revoke 登出时吊销访问令牌，并撤销其对应的刷新令牌家族
+func (s *JWTService) Revoke(claims *JWTClaims) error {
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RevokedAccessToken{
+		UserID:    claims.UserID(),
+		TokenID:   claims.ID,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}).Error; err != nil {
+		return err
+	}
+
+	if claims.FamilyID == "" {
+		return nil
+	}
+	return s.revokeFamily(claims.FamilyID)
+}
+
+// RevokeRefreshToken 撤销刷新令牌所在的家族，令牌不存在时不报错
+// 供访问令牌已过期、只持有刷新令牌的客户端登出
+func (s *JWTService) RevokeRefreshToken(refreshToken string) error {
+	var token models.RefreshToken
+	if err := s.db.Where("token_hash = ?", models.HashToken(refreshToken)).First(&token).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+	return s.revokeFamily(token.FamilyID)
+}
+
+// IssueTwoFactorToken 签发等待两步验证的令牌，不使用Cookie的客户端提交动态码时携带
+func (s *JWTService) IssueTwoFactorToken(user *models.User) (string, error) {
+	jti, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	return s.sign(&JWTClaims{
+		Subject:        strconv.FormatUint(uint64(user.ID), 10),
+		Type:           jwtTypeTwoFactor,
+		SessionVersion: user.SessionVersion,
+		ID:             jti,
+		IssuedAt:       now.Unix(),
+		ExpiresAt:      now.Add(twoFactorTokenTTL).Unix(),
+	})
+}
+
+// ParseTwoFactorToken 校验等待两步验证的令牌
+func (s *JWTService) ParseTwoFactorToken(token string) (*JWTClaims, error) {
+	return s.parse(token, jwtTypeTwoFactor)
+}
+
+// issue 签发访问令牌，并在指定家族中创建新的刷新令牌
+func (s *JWTService) issue(db *gorm.DB, user *models.User, familyID string) (*TokenPair, error) {
+	jti, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	accessToken, err := s.sign(&JWTClaims{
+		Subject:        strconv.FormatUint(uint64(user.ID), 10),
+		Type:           jwtTypeAccess,
+		SessionVersion: user.SessionVersion,
+		FamilyID:       familyID,
+		ID:             jti,
+		IssuedAt:       now.Unix(),
+		ExpiresAt:      now.Add(s.accessTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Create(&models.RefreshToken{
+		UserID:         user.ID,
+		FamilyID:       familyID,
+		TokenHash:      models.HashToken(secret),
+		SessionVersion: user.SessionVersion,
+		ExpiresAt:      now.Add(s.refreshTTL),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int(s.accessTTL.Seconds()),
+		RefreshToken:     secret,
+		RefreshExpiresIn: int(s.refreshTTL.Seconds()),
+	}, nil
+}
+
+// reused 处理已换发过的刷新令牌被再次使用的情况
+func (s *JWTService) reused(familyID string) error {
+	if err := s.revokeFamily(familyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// revokeFamily 撤销家族中所有未撤销的刷新令牌
+func (s *JWTService) revokeFamily(familyID string) error {
+	return s.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// sign 生成HS256签名的令牌
+func (s *JWTService) sign(claims *JWTClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(s.signature(unsigned)), nil
+}
+
+// parse 校验令牌的头部、签名、类型和有效期
+func (s *JWTService) parse(token, tokenType string) (*JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidAccessToken
+	}
+
+	// 只接受HS256，拒绝alg为none或其他算法的令牌
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(rawHeader, &header) != nil || header.Alg != "HS256" {
+		return nil, ErrInvalidAccessToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, s.signature(parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidAccessToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+	var claims JWTClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+
+	if claims.Type != tokenType || claims.UserID() == 0 || claims.ID == "" {
+		return nil, ErrInvalidAccessToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrInvalidAccessToken
+	}
+	return &claims, nil
+}
+
+// signature 计算HMAC-SHA256签名
+func (s *JWTService) signature(unsigned string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
+
+// cleanupExpiredTokens 清理已过期的刷新令牌和访问令牌吊销记录，过期的令牌本身已无法使用
+func (s *SchedulerService) cleanupExpiredTokens() {
+	now := time.Now()
+
+	if err := s.db.Where("expires_at < ?", now).Delete(&models.RefreshToken{}).Error; err != nil {
+		log.Printf("Error cleaning up refresh tokens: %v", err)
+	}
+	if err := s.db.Where("expires_at < ?", now).Delete(&models.RevokedAccessToken{}).Error; err != nil {
+		log.Printf("Error cleaning up revoked access tokens: %v", err)
+	}
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"checkin-system/config"
+	"checkin-system/models"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testJWTSecret = "test-jwt-secret-0123456789abcdef0123456789"
+
+func newTestJWTService(db *gorm.DB) *JWTService {
+	return NewJWTService(db, config.JWTConfig{
+		Secret:     testJWTSecret,
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: 24 * time.Hour,
+	})
+}
+
+// testClaims 返回一份有效的访问令牌载荷
+func testClaims() *JWTClaims {
+	now := time.Now()
+	return &JWTClaims{
+		Subject:   "42",
+		Type:      jwtTypeAccess,
+		ID:        "test-jti",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+	}
+}
+
+// signWithHeader 用服务的密钥为任意头部和载荷签名，模拟攻击者能控制头部的情况
+func signWithHeader(s *JWTService, header string, claims *JWTClaims) string {
+	payload, _ := json.Marshal(claims)
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(s.signature(unsigned))
+}
+
+func TestJWTParse(t *testing.T) {
+	s := newTestJWTService(nil)
+	other := NewJWTService(nil, config.JWTConfig{Secret: "another-secret-0123456789abcdef0123456789"})
+
+	valid, err := s.sign(testClaims())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	parts := strings.Split(valid, ".")
+
+	twoFactor := testClaims()
+	twoFactor.Type = jwtTypeTwoFactor
+	twoFactorToken, _ := s.sign(twoFactor)
+
+	expired := testClaims()
+	expired.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	expiredToken, _ := s.sign(expired)
+
+	noID := testClaims()
+	noID.ID = ""
+	noIDToken, _ := s.sign(noID)
+
+	noSubject := testClaims()
+	noSubject.Subject = ""
+	noSubjectToken, _ := s.sign(noSubject)
+
+	otherToken, _ := other.sign(testClaims())
+
+	tampered := testClaims()
+	tampered.Subject = "1"
+	tamperedPayload, _ := json.Marshal(tampered)
+
+	tests := []struct {
+		name      string
+		token     string
+		tokenType string
+		wantErr   bool
+	}{
+		{"valid access token", valid, jwtTypeAccess, false},
+		{"valid two-factor token", twoFactorToken, jwtTypeTwoFactor, false},
+		{"alg none without signature", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + parts[1] + ".", jwtTypeAccess, true},
+		{"alg none with valid signature", signWithHeader(s, `{"alg":"none","typ":"JWT"}`, testClaims()), jwtTypeAccess, true},
+		{"alg HS512", signWithHeader(s, `{"alg":"HS512","typ":"JWT"}`, testClaims()), jwtTypeAccess, true},
+		{"alg RS256", signWithHeader(s, `{"alg":"RS256","typ":"JWT"}`, testClaims()), jwtTypeAccess, true},
+		{"lowercase alg", signWithHeader(s, `{"alg":"hs256","typ":"JWT"}`, testClaims()), jwtTypeAccess, true},
+		{"two-factor token used as access token", twoFactorToken, jwtTypeAccess, true},
+		{"access token used as two-factor token", valid, jwtTypeTwoFactor, true},
+		{"signed with another secret", otherToken, jwtTypeAccess, true},
+		{"tampered payload", parts[0] + "." + base64.RawURLEncoding.EncodeToString(tamperedPayload) + "." + parts[2], jwtTypeAccess, true},
+		{"expired", expiredToken, jwtTypeAccess, true},
+		{"missing jti", noIDToken, jwtTypeAccess, true},
+		{"missing subject", noSubjectToken, jwtTypeAccess, true},
+		{"two segments", parts[0] + "." + parts[1], jwtTypeAccess, true},
+		{"four segments", valid + ".x", jwtTypeAccess, true},
+		{"garbage", "not-a-token", jwtTypeAccess, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := s.parse(tt.token, tt.tokenType)
+			if tt.wantErr {
+				if err != ErrInvalidAccessToken {
+					t.Errorf("parse() = (%+v, %v), want ErrInvalidAccessToken", claims, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse() error = %v", err)
+			}
+			if claims.UserID() != 42 || claims.Type != tt.tokenType {
+				t.Errorf("parse() claims = %+v", claims)
+			}
+		})
+	}
+}
+
+// openTestDB 连接TEST_DATABASE_DSN指定的PostgreSQL测试库，未设置时跳过测试
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.CheckIn{}, &models.CheckInReminder{}, &models.RefreshToken{}, &models.RevokedAccessToken{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// createTestUser 创建测试用户，测试结束后删除用户及其令牌
+func createTestUser(t *testing.T, db *gorm.DB) *models.User {
+	t.Helper()
+
+	suffix, _ := randomHex(6)
+	user := models.User{
+		Username: "jwt-test-" + suffix,
+		Email:    fmt.Sprintf("jwt-test-%s@example.com", suffix),
+		Password: "x",
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Where("user_id = ?", user.ID).Delete(&models.RefreshToken{})
+		db.Where("user_id = ?", user.ID).Delete(&models.RevokedAccessToken{})
+		db.Unscoped().Delete(&user)
+	})
+	return &user
+}
+
+func TestJWTRefreshRotation(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestJWTService(db)
+	user := createTestUser(t, db)
+
+	first, err := s.IssueTokens(user)
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+
+	second, err := s.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("Refresh returned the same refresh token")
+	}
+
+	third, err := s.Refresh(second.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh rotated token: %v", err)
+	}
+
+	claims, err := s.VerifyAccessToken(third.AccessToken)
+	if err != nil {
+		t.Fatalf("VerifyAccessToken: %v", err)
+	}
+	if claims.UserID() != user.ID {
+		t.Errorf("access token user = %d, want %d", claims.UserID(), user.ID)
+	}
+}
+
+func TestJWTRefreshReuseRevokesFamily(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestJWTService(db)
+	user := createTestUser(t, db)
+
+	first, err := s.IssueTokens(user)
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	second, err := s.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// 再次使用已换发过的令牌，视为令牌被盗，整个家族被撤销
+	if _, err := s.Refresh(first.RefreshToken); err != ErrRefreshTokenReused {
+		t.Fatalf("reusing refresh token error = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := s.Refresh(second.RefreshToken); err != ErrInvalidRefreshToken {
+		t.Errorf("refresh after family revocation error = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	var active int64
+	db.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Count(&active)
+	if active != 0 {
+		t.Errorf("%d refresh tokens still active after reuse", active)
+	}
+
+	// 其他家族（另一次登录）不受影响
+	other, err := s.IssueTokens(user)
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	if _, err := s.Refresh(other.RefreshToken); err != nil {
+		t.Errorf("refresh in another family error = %v", err)
+	}
+}
+
+func TestJWTRevoke(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestJWTService(db)
+	user := createTestUser(t, db)
+
+	pair, err := s.IssueTokens(user)
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	claims, err := s.VerifyAccessToken(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("VerifyAccessToken: %v", err)
+	}
+
+	if err := s.Revoke(claims); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := s.VerifyAccessToken(pair.AccessToken); err != ErrInvalidAccessToken {
+		t.Errorf("revoked access token error = %v, want ErrInvalidAccessToken", err)
+	}
+	if _, err := s.Refresh(pair.RefreshToken); err != ErrInvalidRefreshToken {
+		t.Errorf("refresh after logout error = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestJWTRefreshAfterPasswordChange(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestJWTService(db)
+	user := createTestUser(t, db)
+
+	pair, err := s.IssueTokens(user)
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+
+	// 修改密码会递增会话版本，之前签发的刷新令牌失效
+	db.Model(user).Update("session_version", gorm.Expr("session_version + 1"))
+	if _, err := s.Refresh(pair.RefreshToken); err != ErrInvalidRefreshToken {
+		t.Errorf("refresh after session version change error = %v, want ErrInvalidRefreshToken", err)
+	}
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"checkin-system/config"
+
+	"gopkg.in/gomail.v2"
+)
+
+// memoryMailboxLimit 内存方式最多保留的邮件数，超出时丢弃最早的
+const memoryMailboxLimit = 200
+
+// MailTransport 邮件发送方式
+type MailTransport interface {
+	Send(from string, to []string, m *gomail.Message) error
+}
+
+// Mailbox 保留已发送邮件的发送方式，用于开发环境查看邮件
+type Mailbox interface {
+	Messages() ([]CapturedEmail, error)
+}
+
+// CapturedEmail 开发环境中捕获的邮件
+type CapturedEmail struct {
+	ID      string    `json:"id"`
+	From    string    `json:"from"`
+	To      []string  `json:"to"`
+	Subject string    `json:"subject"`
+	Date    time.Time `json:"date"`
+	Text    string    `json:"text"`
+	HTML    string    `json:"html,omitempty"`
+	Raw     string    `json:"raw"`
+}
+
+// newMailTransport 根据配置创建发送方式
+func newMailTransport(emailConfig config.EmailConfig) MailTransport {
+	switch emailConfig.Transport {
+	case config.MailTransportFile:
+		return &fileTransport{dir: emailConfig.FileDir}
+	case config.MailTransportStdout:
+		return &stdoutTransport{out: os.Stdout}
+	case config.MailTransportMemory:
+		return NewMemoryTransport()
+	default:
+		return newSMTPTransport(emailConfig)
+	}
+}
+
+// fileTransport 将每封邮件写入目录下的.eml文件，可以直接用邮件客户端打开
+type fileTransport struct {
+	dir string
+}
+
+// Send 写入邮件文件，文件名以时间开头便于按发送顺序排列
+func (t *fileTransport) Send(from string, to []string, m *gomail.Message) error {
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		return err
+	}
+
+	suffix, err := randomHex(4)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), suffix)
+	return os.WriteFile(filepath.Join(t.dir, name), buf.Bytes(), 0644)
+}
+
+// Messages 读取目录中的邮件，最新的在前
+func (t *fileTransport) Messages() ([]CapturedEmail, error) {
+	entries, err := os.ReadDir(t.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".eml") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	if len(names) > memoryMailboxLimit {
+		names = names[:memoryMailboxLimit]
+	}
+
+	messages := make([]CapturedEmail, 0, len(names))
+	for _, name := range names {
+		raw, err := os.ReadFile(filepath.Join(t.dir, name))
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, parseCapturedEmail(strings.TrimSuffix(name, ".eml"), raw))
+	}
+	return messages, nil
+}
+
+// stdoutTransport 将邮件原文输出到标准输出
+type stdoutTransport struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// Send 输出邮件原文，前后加分隔行便于在日志中辨认
+func (t *stdoutTransport) Send(from string, to []string, m *gomail.Message) error {
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := fmt.Fprintf(t.out, "===== email from %s to %s =====\n%s\n===== end of email =====\n", from, strings.Join(to, ", "), buf.String())
+	return err
+}
+
+// MemoryTransport 将邮件保存在内存中，用于开发环境和测试
+type MemoryTransport struct {
+	mu       sync.Mutex
+	nextID   int
+	messages []CapturedEmail
+}
+
+// NewMemoryTransport 创建内存发送方式
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{}
+}
+
+// Send 保存邮件
+func (t *MemoryTransport) Send(from string, to []string, m *gomail.Message) error {
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.nextID++
+	t.messages = append(t.messages, parseCapturedEmail(strconv.Itoa(t.nextID), buf.Bytes()))
+	if len(t.messages) > memoryMailboxLimit {
+		t.messages = t.messages[len(t.messages)-memoryMailboxLimit:]
+	}
+	return nil
+}
+
+// Messages 返回保存的邮件，最新的在前
+func (t *MemoryTransport) Messages() ([]CapturedEmail, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	messages := make([]CapturedEmail, len(t.messages))
+	for i, message := range t.messages {
+		messages[len(t.messages)-1-i] = message
+	}
+	return messages, nil
+}
+
+// Reset 清空保存的邮件
+func (t *MemoryTransport) Reset() {
+	t.mu.Lock()
+	t.messages = nil
+	t.mu.Unlock()
+}
+
+// parseCapturedEmail 解析邮件原文，提取收发件人、主题和正文
+// 解析失败时仍然返回原文，开发页面至少可以查看原始内容
+func parseCapturedEmail(id string, raw []byte) CapturedEmail {
+	captured := CapturedEmail{ID: id, Raw: string(raw)}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return captured
+	}
+
+	decoder := new(mime.WordDecoder)
+	captured.Subject, _ = decoder.DecodeHeader(msg.Header.Get("Subject"))
+	captured.From, _ = decoder.DecodeHeader(msg.Header.Get("From"))
+	if to, err := msg.Header.AddressList("To"); err == nil {
+		for _, addr := range to {
+			captured.To = append(captured.To, addr.Address)
+		}
+	}
+	captured.Date, _ = msg.Header.Date()
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		body, _ := io.ReadAll(decodeTransferEncoding(msg.Body, msg.Header.Get("Content-Transfer-Encoding")))
+		captured.setBody(mediaType, string(body))
+		return captured
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		// multipart已处理quoted-printable，这里只需处理其他编码
+		body, _ := io.ReadAll(decodeTransferEncoding(part, part.Header.Get("Content-Transfer-Encoding")))
+		captured.setBody(partType, string(body))
+	}
+	return captured
+}
+
+// setBody 按内容类型记录正文
+func (c *CapturedEmail) setBody(mediaType, body string) {
+	switch mediaType {
+	case "text/html":
+		c.HTML = body
+	case "text/plain":
+		c.Text = body
+	}
+}
+
+// decodeTransferEncoding 按Content-Transfer-Encoding解码正文
+func decodeTransferEncoding(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	}
+	return r
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"checkin-system/models"
+
+	"gorm.io/gorm"
+)
+
+// Notification 一条待发送的通知
+type Notification struct {
+	Event     string                 // 通知事件，用于匹配用户渠道的订阅
+	User      *models.User           // 通知所属的用户
+	Template  string                 // 渲染通知内容使用的模板
+	Data      map[string]interface{} // 模板变量
+	Channel   string                 // 限定渠道类型，为空时发送到所有订阅该事件的渠道
+	ChannelID uint                   // 只发送到用户的这一个渠道，不检查订阅和启用状态（用于测试通知）
+	Target    string                 // 指定收件地址时不再查找用户渠道，直接通过Channel（默认邮件）发送
+	Sensitive bool                   // 内容敏感，邮件发送成功后从发件箱中清除正文
+
+	ReminderID     uint   // 提醒通知所属的提醒，退订链接会关闭这条提醒
+	UnsubscribeURL string // 可退订事件的退订链接，由NotificationRouter生成
+	OutboxID       uint   // 通过邮件发送时写入的发件箱邮件ID，指定Target时可用于跟踪送达
+}
+
+// Notifier 通知渠道的发送实现
+// 指定Target发送时channel是只有Type和Target的临时渠道，ID为0
+type Notifier interface {
+	Send(channel *models.NotificationChannel, n *Notification) error
+}
+
+// EmailNotifier 通过发件箱发送邮件通知
+type EmailNotifier struct {
+	emailService *EmailService
+}
+
+// NewEmailNotifier 创建邮件通知渠道
+func NewEmailNotifier(emailService *EmailService) *EmailNotifier {
+	return &EmailNotifier{emailService: emailService}
+}
+
+// Send 渲染模板并写入发件箱，发送失败由发件箱任务重试
+// 渠道未设置地址时发送到账户邮箱；有退订链接时模板中可以通过UnsubscribeURL变量引用
+func (n *EmailNotifier) Send(channel *models.NotificationChannel, notification *Notification) error {
+	target := channel.Target
+	if target == "" {
+		target = notification.User.Email
+	}
+
+	data := notification.Data
+	if notification.UnsubscribeURL != "" {
+		data = make(map[string]interface{}, len(notification.Data)+1)
+		for k, v := range notification.Data {
+			data[k] = v
+		}
+		data["UnsubscribeURL"] = notification.UnsubscribeURL
+	}
+
+	message := models.EmailOutbox{
+		UserID:         notification.User.ID,
+		Event:          notification.Event,
+		Template:       notification.Template,
+		Locale:         notification.User.Locale,
+		To:             target,
+		Sensitive:      notification.Sensitive,
+		UnsubscribeURL: notification.UnsubscribeURL,
+	}
+	if err := n.emailService.Queue(&message, data); err != nil {
+		return err
+	}
+	notification.OutboxID = message.ID
+	return nil
+}
+
+// WebhookNotifier 将通知交给WebhookService，以签名的JSON POST到用户配置的URL，失败时按退避策略重试
+type WebhookNotifier struct {
+	templates *EmailService
+	webhooks  *WebhookService
+}
+
+// NewWebhookNotifier 创建webhook通知渠道，通知内容使用邮件模板渲染
+func NewWebhookNotifier(templates *EmailService, webhooks *WebhookService) *WebhookNotifier {
+	return &WebhookNotifier{
+		templates: templates,
+		webhooks:  webhooks,
+	}
+}
+
+// webhookPayload webhook请求体
+type webhookPayload struct {
+	Event    string                 `json:"event"`
+	UserID   uint                   `json:"user_id"`
+	Username string                 `json:"username"`
+	Subject  string                 `json:"subject"`
+	Text     string                 `json:"text"`
+	Data     map[string]interface{} `json:"data"`
+	SentAt   time.Time              `json:"sent_at"`
+}
+
+// Send 渲染模板并记录投递，返回时请求可能尚未发出
+// 只能发送到用户已保存的渠道，签名密钥和投递记录都属于渠道
+func (n *WebhookNotifier) Send(channel *models.NotificationChannel, notification *Notification) error {
+	if channel.ID == 0 {
+		return errors.New("webhook notifications require a saved channel")
+	}
+
+	subject, text, err := n.templates.RenderTemplate(notification.Template, notification.User.Locale, notification.Data)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(webhookPayload{
+		Event:    notification.Event,
+		UserID:   notification.User.ID,
+		Username: notification.User.Username,
+		Subject:  subject,
+		Text:     text,
+		Data:     notification.Data,
+		SentAt:   time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return n.webhooks.EnqueueChannel(channel, notification.Event, payload)
+}
+
+// NotificationRouter 按用户配置的渠道分发通知事件
+type NotificationRouter struct {
+	db          *gorm.DB
+	unsubscribe *UnsubscribeService
+	notifiers   map[string]Notifier
+}
+
+// NewNotificationRouter 创建通知路由，默认注册邮件和webhook渠道
+func NewNotificationRouter(db *gorm.DB, emailService *EmailService, webhooks *WebhookService, unsubscribe *UnsubscribeService) *NotificationRouter {
+	return &NotificationRouter{
+		db:          db,
+		unsubscribe: unsubscribe,
+		notifiers: map[string]Notifier{
+			models.NotificationChannelEmail:   NewEmailNotifier(emailService),
+			models.NotificationChannelWebhook: NewWebhookNotifier(emailService, webhooks),
+		},
+	}
+}
+
+// Register 注册或替换一种渠道的发送实现
+func (r *NotificationRouter) Register(channel string, notifier Notifier) {
+	r.notifiers[channel] = notifier
+}
+
+// Dispatch 分发一条通知
+// 只要有一个渠道发送成功就视为成功，全部失败时返回合并后的错误
+// 可退订的事件附带退订链接，用户已退订的类别不再发送到邮件渠道
+func (r *NotificationRouter) Dispatch(n *Notification) error {
+	if n.Target != "" {
+		channelType := n.Channel
+		if channelType == "" {
+			channelType = models.NotificationChannelEmail
+		}
+		return r.send(&models.NotificationChannel{UserID: n.User.ID, Type: channelType, Target: n.Target}, n)
+	}
+
+	if n.ChannelID != 0 {
+		var channel models.NotificationChannel
+		if err := r.db.Where("id = ? AND user_id = ?", n.ChannelID, n.User.ID).First(&channel).Error; err != nil {
+			return err
+		}
+		if channel.NeedsVerification() {
+			return fmt.Errorf("email channel %d has not been confirmed by its recipient", channel.ID)
+		}
+		return r.send(&channel, n)
+	}
+
+	query := r.db.Where("user_id = ? AND is_enabled = ?", n.User.ID, true)
+	if n.Channel != "" {
+		query = query.Where("type = ?", n.Channel)
+	}
+	var channels []models.NotificationChannel
+	if err := query.Order("id ASC").Find(&channels).Error; err != nil {
+		return err
+	}
+
+	emailOptedOut := false
+	if models.IsUnsubscribableEvent(n.Event) {
+		var count int64
+		r.db.Model(&models.EmailOptOut{}).Where("user_id = ? AND event = ?", n.User.ID, n.Event).Count(&count)
+		emailOptedOut = count > 0
+		n.UnsubscribeURL = r.unsubscribe.GenerateURL(UnsubscribeClaims{
+			UserID:     n.User.ID,
+			ReminderID: n.ReminderID,
+			Event:      n.Event,
+		})
+	}
+
+	var errs []error
+	matched, sent := 0, 0
+	for _, channel := range channels {
+		// 收件人尚未确认的邮件渠道视为不存在，必要时回退到账户邮箱
+		if !channel.Accepts(n.Event) || channel.NeedsVerification() {
+			continue
+		}
+		matched++
+
+		if emailOptedOut && channel.Type == models.NotificationChannelEmail {
+			continue
+		}
+
+		if err := r.send(&channel, n); err != nil {
+			log.Printf("Error sending %s notification to channel %d of user %d: %v", n.Event, channel.ID, n.User.ID, err)
+			errs = append(errs, err)
+			continue
+		}
+		sent++
+	}
+
+	if matched == 0 {
+		// 没有渠道订阅该事件时回退到账户邮箱
+		if n.Channel == "" || n.Channel == models.NotificationChannelEmail {
+			if emailOptedOut {
+				return nil
+			}
+			return r.send(&models.NotificationChannel{UserID: n.User.ID, Type: models.NotificationChannelEmail}, n)
+		}
+		return fmt.Errorf("no enabled %s channel subscribed to %s", n.Channel, n.Event)
+	}
+	// 全部渠道都因退订被跳过时errs为空，不视为失败
+	if sent == 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// send 通过渠道类型对应的实现发送
+func (r *NotificationRouter) send(channel *models.NotificationChannel, n *Notification) error {
+	notifier, ok := r.notifiers[channel.Type]
+	if !ok {
+		return fmt.Errorf("unsupported notification channel %q", channel.Type)
+	}
+	return notifier.Send(channel, n)
+}
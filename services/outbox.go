@@ -0,0 +1,180 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"checkin-system/models"
+)
+
+const (
+	outboxMaxAttempts  = 6                // 默认最多发送次数，用尽后进入死信状态
+	outboxBaseBackoff  = time.Minute      // 第一次重试的间隔，之后每次翻倍
+	outboxMaxBackoff   = 2 * time.Hour    // 重试间隔上限
+	outboxClaimLease   = 5 * time.Minute  // 发送中的邮件在此期间不会被再次领取
+	outboxPollInterval = 15 * time.Second // 发件箱轮询间隔
+	outboxBatchSize    = 50               // 每轮最多处理的邮件数
+)
+
+// ErrEmailNotResendable 敏感邮件发送后正文已清除，无法重发
+var ErrEmailNotResendable = errors.New("email body is no longer available")
+
+// Queue 渲染模板并写入发件箱，由后台任务发送
+// message中需要设置UserID、To、Template，可选Locale、Event和Sensitive
+func (e *EmailService) Queue(message *models.EmailOutbox, data map[string]interface{}) error {
+	rendered, err := e.RenderEmail(message.Template, message.Locale, data)
+	if err != nil {
+		return err
+	}
+
+	message.Subject = rendered.Subject
+	message.Body = rendered.Body
+	message.HTMLBody = rendered.HTML
+	message.Status = models.EmailStatusPending
+	message.MaxAttempts = outboxMaxAttempts
+	message.NextAttemptAt = time.Now()
+
+	if err := e.db.Create(message).Error; err != nil {
+		return err
+	}
+
+	e.notifyOutbox()
+	return nil
+}
+
+// Resend 将发件箱中的邮件复制为一封新邮件重新发送
+func (e *EmailService) Resend(original *models.EmailOutbox) (*models.EmailOutbox, error) {
+	if original.Sensitive && original.Body == "" {
+		return nil, ErrEmailNotResendable
+	}
+
+	message := models.EmailOutbox{
+		UserID:         original.UserID,
+		Event:          original.Event,
+		Template:       original.Template,
+		Locale:         original.Locale,
+		To:             original.To,
+		Subject:        original.Subject,
+		Body:           original.Body,
+		HTMLBody:       original.HTMLBody,
+		Sensitive:      original.Sensitive,
+		UnsubscribeURL: original.UnsubscribeURL,
+		Status:         models.EmailStatusPending,
+		MaxAttempts:    outboxMaxAttempts,
+		NextAttemptAt:  time.Now(),
+		ResendOf:       original.ID,
+	}
+	if err := e.db.Create(&message).Error; err != nil {
+		return nil, err
+	}
+
+	e.notifyOutbox()
+	return &message, nil
+}
+
+// StartOutboxWorker 启动发件箱后台任务，定期发送到期的邮件，有新邮件入队时立即处理
+func (e *EmailService) StartOutboxWorker() {
+	go func() {
+		ticker := time.NewTicker(outboxPollInterval)
+		defer ticker.Stop()
+
+		for {
+			e.processOutbox()
+
+			select {
+			case <-ticker.C:
+			case <-e.wake:
+			}
+		}
+	}()
+	log.Println("Email outbox worker started")
+}
+
+// notifyOutbox 唤醒发件箱任务，任务正忙时合并为一次
+func (e *EmailService) notifyOutbox() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// processOutbox 领取并发送所有到期的邮件
+func (e *EmailService) processOutbox() {
+	now := time.Now()
+
+	var messages []models.EmailOutbox
+	err := e.db.Where("status = ? AND next_attempt_at <= ?", models.EmailStatusPending, now).
+		Order("next_attempt_at ASC").
+		Limit(outboxBatchSize).
+		Find(&messages).Error
+	if err != nil {
+		log.Printf("Error fetching due emails: %v", err)
+		return
+	}
+
+	for _, message := range messages {
+		// 条件更新领取邮件，多实例部署时避免重复发送
+		result := e.db.Model(&models.EmailOutbox{}).
+			Where("id = ? AND status = ? AND next_attempt_at <= ?", message.ID, models.EmailStatusPending, now).
+			Update("next_attempt_at", now.Add(outboxClaimLease))
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		e.deliverOutbox(message)
+	}
+}
+
+// deliverOutbox 发送一封邮件并记录结果，失败时按指数退避安排重试，次数用尽后进入死信状态
+// 敏感邮件在发送成功或进入死信状态后清除正文
+func (e *EmailService) deliverOutbox(message models.EmailOutbox) {
+	err := e.sendEmail(&message)
+
+	now := time.Now()
+	message.Attempts++
+	updates := map[string]interface{}{
+		"attempts": message.Attempts,
+	}
+
+	if err == nil {
+		updates["status"] = models.EmailStatusSent
+		updates["sent_at"] = now
+		updates["last_error"] = ""
+		if message.Sensitive {
+			updates["body"] = ""
+			updates["html_body"] = ""
+		}
+	} else {
+		errMessage := err.Error()
+		if len(errMessage) > 500 {
+			errMessage = errMessage[:500]
+		}
+		updates["last_error"] = errMessage
+
+		maxAttempts := message.MaxAttempts
+		if maxAttempts <= 0 {
+			maxAttempts = outboxMaxAttempts
+		}
+		if message.Attempts >= maxAttempts {
+			updates["status"] = models.EmailStatusDead
+			// 死信不会再自动发送，敏感正文同样清除，需要时由业务方重新入队
+			if message.Sensitive {
+				updates["body"] = ""
+				updates["html_body"] = ""
+			}
+			log.Printf("Email %d to %s moved to dead letter after %d attempts: %v", message.ID, message.To, message.Attempts, err)
+		} else {
+			updates["next_attempt_at"] = now.Add(exponentialBackoff(outboxBaseBackoff, outboxMaxBackoff, message.Attempts))
+			log.Printf("Error sending email %d to %s (attempt %d): %v", message.ID, message.To, message.Attempts, err)
+		}
+	}
+
+	if err := e.db.Model(&message).Updates(updates).Error; err != nil {
+		log.Printf("Error updating email %d: %v", message.ID, err)
+	}
+
+	if err == nil && message.Event == models.NotificationEventVaultRelease {
+		e.markVaultRecipientDelivered(message.ID, now)
+	}
+}
@@ -12,29 +12,50 @@ import (
 
 // SchedulerService 定时任务服务
 type SchedulerService struct {
-	db           *gorm.DB
-	emailService *EmailService
-	cron         *cron.Cron
+	db          *gorm.DB
+	notifier    *NotificationRouter
+	linkService *CheckInLinkService
+	vaultCipher *VaultCipher
+	webhooks    *WebhookService
+	cron        *cron.Cron
 }
 
 // NewSchedulerService 创建定时任务服务
-func NewSchedulerService(db *gorm.DB, emailService *EmailService) *SchedulerService {
+func NewSchedulerService(db *gorm.DB, notifier *NotificationRouter, linkService *CheckInLinkService, vaultCipher *VaultCipher, webhooks *WebhookService) *SchedulerService {
 	c := cron.New()
 	
 	return &SchedulerService{
-		db:           db,
-		emailService: emailService,
-		cron:         c,
+		db:          db,
+		notifier:    notifier,
+		linkService: linkService,
+		vaultCipher: vaultCipher,
+		webhooks:    webhooks,
+		cron:        c,
 	}
 }
 
 // Start 启动定时任务
 func (s *SchedulerService) Start() {
-	// 每小时检查一次提醒任务
-	s.cron.AddFunc("0 * * * *", s.checkReminders)
+	// 每分钟检查一次提醒任务，提醒时间由用户自行设置
+	s.cron.AddFunc("* * * * *", s.checkReminders)
+
+	// 每分钟检查一次签到截止时间，按用户各自的截止时间和时区判断
+	s.cron.AddFunc("* * * * *", s.checkDeadlines)
 	
-	// 每天早上8点检查缺签用户
-	s.cron.AddFunc("0 8 * * *", s.checkMissedCheckIns)
+	// 每小时检查一次缺签用户，按升级策略逐级通知
+	s.cron.AddFunc("30 * * * *", s.checkMissedCheckIns)
+
+	// 每小时检查一次需要释放的遗言消息
+	s.cron.AddFunc("45 * * * *", s.checkVaultReleases)
+
+	// 每小时检查一次需要发送的签到摘要，按用户时区在周期结束后发送
+	s.cron.AddFunc("15 * * * *", s.checkDigests)
+
+	// 每分钟重试一次到期的webhook投递
+	s.cron.AddFunc("* * * * *", s.webhooks.DeliverDue)
+
+	// 每小时清理一次已过期的刷新令牌和吊销记录
+	s.cron.AddFunc("50 * * * *", s.cleanupExpiredTokens)
 	
 	s.cron.Start()
 	log.Println("Scheduler service started")
@@ -46,61 +67,237 @@ func (s *SchedulerService) Stop() {
 	log.Println("Scheduler service stopped")
 }
 
-// checkReminders 检查提醒任务
+// reminderRetryDelay 提醒发送失败后到下一次尝试的最短间隔
+const reminderRetryDelay = 15 * time.Minute
+
+// checkReminders 检查提醒任务，逐条处理已到期的提醒
 func (s *SchedulerService) checkReminders() {
-	log.Println("Checking reminders...")
-	
+	now := time.Now()
+
 	var reminders []models.CheckInReminder
-	err := s.db.Where("is_enabled = ?", true).Find(&reminders).Error
+	err := s.db.Where("is_enabled = ? AND next_reminder <= ?", true, now).Order("user_id ASC").Find(&reminders).Error
 	if err != nil {
 		log.Printf("Error fetching reminders: %v", err)
 		return
 	}
+	if len(reminders) == 0 {
+		return
+	}
 	
-	now := time.Now()
+	log.Printf("Processing %d due reminders...", len(reminders))
+	
+	// 批量加载提醒所属的用户
+	userIDs := make([]uint, 0, len(reminders))
 	for _, reminder := range reminders {
-		if reminder.NextReminder.Before(now) || reminder.NextReminder.Equal(now) {
-			var user models.User
-			if err := s.db.First(&user, reminder.UserID).Error; err != nil {
-				log.Printf("Error finding user %d: %v", reminder.UserID, err)
-				continue
-			}
-			
-			// 发送提醒邮件
-			var err error
-			switch reminder.ReminderFrequency {
-			case "daily":
-				err = s.emailService.SendDailyReminder(&user)
-			case "hourly":
-				err = s.emailService.SendHourlyReminder(&user)
-			default:
-				err = s.emailService.SendHourlyReminder(&user)
-			}
-			
-			if err != nil {
-				log.Printf("Error sending reminder to user %d: %v", reminder.UserID, err)
-				continue
-			}
-			
-			// 更新下次提醒时间
-			reminder.LastReminder = now
-			var lastCheckIn time.Time
-			s.db.Model(&models.CheckIn{}).
-				Where("user_id = ?", reminder.UserID).
-				Order("checkin_at DESC").
-				Limit(1).
-				Pluck("checkin_at", &lastCheckIn)
-			
-			reminder.NextReminder = reminder.CalculateNextReminder(lastCheckIn)
-			
-			if err := s.db.Save(&reminder).Error; err != nil {
-				log.Printf("Error updating reminder %d: %v", reminder.ID, err)
+		userIDs = append(userIDs, reminder.UserID)
+	}
+	var users []models.User
+	if err := s.db.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		log.Printf("Error fetching reminder users: %v", err)
+		return
+	}
+	usersByID := make(map[uint]*models.User, len(users))
+	for i := range users {
+		usersByID[users[i].ID] = &users[i]
+	}
+	
+	paused := make(map[uint]bool)
+	for _, reminder := range reminders {
+		user, ok := usersByID[reminder.UserID]
+		if !ok {
+			log.Printf("Error finding user %d for reminder %d", reminder.UserID, reminder.ID)
+			continue
+		}
+		
+		// 暂停期间不发送提醒，每个用户只查询一次
+		isPaused, checked := paused[user.ID]
+		if !checked {
+			isPaused = models.RemindersMuted(s.userPauses(user.ID), now)
+			paused[user.ID] = isPaused
+		}
+		if isPaused {
+			continue
+		}
+		
+		// 当前签到周期（用户时区的今天）已经签到的用户不再提醒，直接推迟到下一个周期
+		loc := user.Location()
+		lastCheckIn := s.lastCheckInTime(user.ID)
+		dayStart, _ := models.DayBounds(now, loc)
+		updates := map[string]interface{}{}
+		sendFailed := false
+		if lastCheckIn.IsZero() || lastCheckIn.Before(dayStart) {
+			// 发送失败时同样推进下次提醒时间，避免每分钟重试同一条提醒
+			if err := s.sendReminder(&reminder, user, now); err != nil {
+				log.Printf("Error sending reminder %d to user %d: %v", reminder.ID, reminder.UserID, err)
+				sendFailed = true
+			} else {
+				reminder.LastReminder = now
+				updates["last_reminder"] = now
+
+				s.webhooks.Emit(user.ID, models.WebhookEventReminderSent, map[string]interface{}{
+					"reminder_id": reminder.ID,
+					"name":        reminder.Name,
+					"channel":     reminder.Channel,
+					"frequency":   reminder.ReminderFrequency,
+					"sent_at":     now,
+				})
 			}
 		}
+		
+		// 更新下次提醒时间，只更新调度字段以免覆盖用户同时修改的设置
+		reminder.NextReminder = reminder.CalculateNextReminder(lastCheckIn, loc)
+		if sendFailed && !reminder.NextReminder.IsZero() && reminder.NextReminder.Before(now.Add(reminderRetryDelay)) {
+			// 按间隔计算的时间可能仍在过去（上次提醒未更新），至少等待reminderRetryDelay再重试
+			reminder.NextReminder = now.Add(reminderRetryDelay)
+		}
+		updates["next_reminder"] = reminder.NextReminder
+		
+		if err := s.db.Model(&reminder).Updates(updates).Error; err != nil {
+			log.Printf("Error updating reminder %d: %v", reminder.ID, err)
+		}
 	}
 }
 
-// checkMissedCheckIns 检查缺签用户
+// sendReminder 按提醒的渠道和频率发送一条提醒
+func (s *SchedulerService) sendReminder(reminder *models.CheckInReminder, user *models.User, now time.Time) error {
+	// 生成用户时区中今天的一键签到链接
+	checkInURL, err := s.linkService.GenerateURL(user.ID, now.In(user.Location()))
+	if err != nil {
+		return err
+	}
+	
+	templateKey := "hourly_reminder"
+	if reminder.ReminderFrequency == "daily" {
+		templateKey = "daily_reminder"
+	}
+
+	// 按提醒指定的渠道类型发送到用户配置的通知渠道
+	return s.notifier.Dispatch(&Notification{
+		Event:    models.NotificationEventReminder,
+		User:     user,
+		Template: templateKey,
+		Data: map[string]interface{}{
+			"Username":   user.Username,
+			"CheckInURL": checkInURL,
+		},
+		Channel:    reminder.Channel,
+		ReminderID: reminder.ID,
+	})
+}
+
+// checkDeadlines 检查已过签到截止时间但当天仍未签到的用户
+func (s *SchedulerService) checkDeadlines() {
+	// 已停用的提醒不检查截止时间
+	var reminders []models.CheckInReminder
+	if err := s.db.Where("is_enabled = ? AND check_in_deadline <> ?", true, "").Find(&reminders).Error; err != nil {
+		log.Printf("Error fetching reminders with deadline: %v", err)
+		return
+	}
+	if len(reminders) == 0 {
+		return
+	}
+
+	// 批量加载提醒所属的用户和暂停记录
+	userIDs := make([]uint, 0, len(reminders))
+	for _, reminder := range reminders {
+		userIDs = append(userIDs, reminder.UserID)
+	}
+	var users []models.User
+	if err := s.db.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		log.Printf("Error fetching deadline users: %v", err)
+		return
+	}
+	usersByID := make(map[uint]*models.User, len(users))
+	for i := range users {
+		usersByID[users[i].ID] = &users[i]
+	}
+	var pauses []models.CheckInPause
+	if err := s.db.Where("user_id IN ?", userIDs).Find(&pauses).Error; err != nil {
+		log.Printf("Error fetching deadline pauses: %v", err)
+		return
+	}
+	pausesByUser := make(map[uint][]models.CheckInPause)
+	for _, pause := range pauses {
+		pausesByUser[pause.UserID] = append(pausesByUser[pause.UserID], pause)
+	}
+
+	now := time.Now()
+	warned := make(map[uint]bool)
+	for _, reminder := range reminders {
+		user, ok := usersByID[reminder.UserID]
+		if !ok {
+			continue
+		}
+
+		// 同一用户有多条带截止时间的提醒时，一天只警告一次
+		if warned[user.ID] {
+			continue
+		}
+
+		loc := user.Location()
+		today := now.In(loc).Format("2006-01-02")
+		if reminder.LastDeadlineMiss == today {
+			continue
+		}
+
+		deadline, ok := reminder.DeadlineOn(now, loc)
+		if !ok || now.Before(deadline) {
+			continue
+		}
+
+		// 暂停期间不算缺签
+		if models.ActivePause(pausesByUser[user.ID], now) != nil {
+			continue
+		}
+
+		dayStart, _ := models.DayBounds(now, loc)
+		var count int64
+		s.db.Model(&models.CheckIn{}).
+			Where("user_id = ? AND checkin_at >= ? AND checkin_at < ?", user.ID, dayStart, deadline).
+			Count(&count)
+		if count > 0 {
+			continue
+		}
+
+		checkInURL, err := s.linkService.GenerateURL(user.ID, now.In(loc))
+		if err != nil {
+			log.Printf("Error generating check-in link for user %d: %v", user.ID, err)
+			continue
+		}
+
+		err = s.notifier.Dispatch(&Notification{
+			Event:    models.NotificationEventDeadlineMissed,
+			User:     user,
+			Template: "deadline_missed",
+			Data: map[string]interface{}{
+				"Username":   user.Username,
+				"Deadline":   reminder.CheckInDeadline,
+				"CheckInURL": checkInURL,
+			},
+		})
+		if err != nil {
+			log.Printf("Error sending deadline missed warning to user %d: %v", user.ID, err)
+			continue
+		}
+
+		// 只更新截止记录字段，避免覆盖并发修改的其他提醒设置
+		if err := s.db.Model(&models.CheckInReminder{}).
+			Where("user_id = ? AND is_enabled = ? AND check_in_deadline <> ?", user.ID, true, "").
+			Update("last_deadline_miss", today).Error; err != nil {
+			log.Printf("Error updating reminders of user %d: %v", user.ID, err)
+		}
+		warned[user.ID] = true
+
+		s.webhooks.Emit(user.ID, models.WebhookEventCheckInMissed, map[string]interface{}{
+			"reason":   "deadline",
+			"day":      today,
+			"deadline": reminder.CheckInDeadline,
+		})
+		log.Printf("User %s missed check-in deadline %s", user.Username, reminder.CheckInDeadline)
+	}
+}
+
+// checkMissedCheckIns 检查缺签用户，按各自的升级策略触发到期的阶段
 func (s *SchedulerService) checkMissedCheckIns() {
 	log.Println("Checking missed check-ins...")
 	
@@ -112,52 +309,47 @@ func (s *SchedulerService) checkMissedCheckIns() {
 	}
 	
 	for _, user := range users {
-		// 检查是否连续两天未签到
-		if s.hasMissedCheckIns(user.ID) {
-			// 发送缺签提醒邮件
-			if err := s.emailService.SendMissedCheckInWarning(&user); err != nil {
-				log.Printf("Error sending missed checkin warning to user %d: %v", user.ID, err)
-			} else {
-				log.Printf("Sent missed checkin warning to user %s", user.Username)
-			}
-		}
+		s.evaluateEscalation(&user)
 	}
 }
 
-// hasMissedCheckIns 检查用户是否连续两天未签到
-func (s *SchedulerService) hasMissedCheckIns(userID uint) bool {
-	// 获取最近3天的签到记录
-	threeDaysAgo := time.Now().AddDate(0, 0, -3)
-	var checkIns []models.CheckIn
-	
-	err := s.db.Where("user_id = ? AND checkin_at >= ?", userID, threeDaysAgo).
+// lastCheckInTime 获取用户最后一次签到时间，没有签到记录时返回零值
+func (s *SchedulerService) lastCheckInTime(userID uint) time.Time {
+	var lastCheckIn time.Time
+	s.db.Model(&models.CheckIn{}).
+		Where("user_id = ?", userID).
 		Order("checkin_at DESC").
-		Find(&checkIns).Error
-	if err != nil {
-		return false
+		Limit(1).
+		Pluck("checkin_at", &lastCheckIn)
+	return lastCheckIn
+}
+
+// userPauses 获取用户的所有暂停时段
+func (s *SchedulerService) userPauses(userID uint) []models.CheckInPause {
+	var pauses []models.CheckInPause
+	s.db.Where("user_id = ?", userID).Find(&pauses)
+	return pauses
+}
+
+// silenceStart 计算用户的失联起点：最后一次签到（从未签到时为注册时间）与最近一次暂停结束时间中较晚的一个
+// 同时返回用于邮件展示的最后签到时间
+func (s *SchedulerService) silenceStart(user *models.User, pauses []models.CheckInPause) (time.Time, string) {
+	silenceSince := s.lastCheckInTime(user.ID)
+	lastCheckIn := silenceSince.Format("2006-01-02 15:04")
+	if silenceSince.IsZero() {
+		// 从未签到过的用户以注册时间作为失联起点
+		silenceSince = user.CreatedAt
+		lastCheckIn = "从未签到"
 	}
-	
-	// 检查今天和昨天是否有签到
-	today := time.Now()
-	yesterday := today.AddDate(0, 0, -1)
-	
-	hasToday := false
-	hasYesterday := false
-	
-	for _, checkIn := range checkIns {
-		if checkIn.CheckInAt.Year() == today.Year() &&
-			checkIn.CheckInAt.Month() == today.Month() &&
-			checkIn.CheckInAt.Day() == today.Day() {
-			hasToday = true
-		}
-		
-		if checkIn.CheckInAt.Year() == yesterday.Year() &&
-			checkIn.CheckInAt.Month() == yesterday.Month() &&
-			checkIn.CheckInAt.Day() == yesterday.Day() {
-			hasYesterday = true
+
+	// 暂停期间不算失联，从暂停结束时重新计时
+	now := time.Now()
+	for _, pause := range pauses {
+		end := pause.EndTime()
+		if end.After(silenceSince) && !end.After(now) {
+			silenceSince = end
 		}
 	}
-	
-	// 如果今天和昨天都没有签到，则缺签
-	return !hasToday && !hasYesterday
-}
\ No newline at end of file
+
+	return silenceSince, lastCheckIn
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// tokenSigner 生成和校验 base64(负载).签名 格式的令牌，签名为HMAC-SHA256
+// 负载以用途开头，使用同一密钥的不同用途的令牌不能混用
+type tokenSigner struct {
+	purpose string
+	secret  []byte
+}
+
+// sign 将字段以|连接后签名，字段中不能包含|
+func (t tokenSigner) sign(fields ...string) string {
+	raw := t.purpose + "|" + strings.Join(fields, "|")
+	payload := base64.RawURLEncoding.EncodeToString([]byte(raw))
+	return payload + "." + t.signature(payload)
+}
+
+// verify 校验签名和用途，返回签名时的字段；字段数不是n时视为无效
+func (t tokenSigner) verify(token string, n int) ([]string, bool) {
+	dot := strings.LastIndex(token, ".")
+	if dot <= 0 {
+		return nil, false
+	}
+
+	payload, signature := token[:dot], token[dot+1:]
+	if !hmac.Equal([]byte(signature), []byte(t.signature(payload))) {
+		return nil, false
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, false
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != n+1 || parts[0] != t.purpose {
+		return nil, false
+	}
+	return parts[1:], true
+}
+
+// signature 计算负载的HMAC-SHA256签名
+func (t tokenSigner) signature(payload string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"checkin-system/config"
+
+	"gopkg.in/gomail.v2"
+)
+
+// SMTP连接参数
+const (
+	smtpDialTimeout = 10 * time.Second
+	smtpIdleTimeout = 30 * time.Second // 空闲超过该时长的连接不再复用，多数服务器会在一分钟左右断开空闲连接
+)
+
+// smtpTransport 按配置的端口和TLS模式投递邮件
+// gomail的Dialer总是尝试STARTTLS且无法强制要求，这里直接使用net/smtp以便严格遵循SMTP_TLS_MODE
+// 发送完成的连接会保留一段时间，调度任务集中发送时复用连接，避免每封邮件都重新握手和认证
+type smtpTransport struct {
+	config config.EmailConfig
+	mu     sync.Mutex
+	idle   []*smtpConn
+}
+
+// smtpConn 一个已完成握手和认证的SMTP连接
+type smtpConn struct {
+	client   *smtp.Client
+	lastUsed time.Time
+}
+
+// newSMTPTransport 创建SMTP发送器
+func newSMTPTransport(emailConfig config.EmailConfig) *smtpTransport {
+	return &smtpTransport{config: emailConfig}
+}
+
+// Send 发送一封邮件
+// 复用的连接可能已被服务器断开，此时换用新连接重试一次
+func (t *smtpTransport) Send(from string, to []string, m *gomail.Message) error {
+	conn, reused, err := t.get()
+	if err != nil {
+		return err
+	}
+
+	err = t.deliver(conn, from, to, m)
+	if err != nil && reused && isConnectionError(err) {
+		conn.client.Close()
+		if conn, err = t.dial(); err != nil {
+			return err
+		}
+		err = t.deliver(conn, from, to, m)
+	}
+
+	if err != nil {
+		conn.client.Close()
+		return err
+	}
+
+	t.put(conn)
+	return nil
+}
+
+// Close 关闭所有空闲连接
+func (t *smtpTransport) Close() {
+	t.mu.Lock()
+	idle := t.idle
+	t.idle = nil
+	t.mu.Unlock()
+
+	for _, conn := range idle {
+		conn.client.Quit()
+	}
+}
+
+// get 取出一个可用连接，没有空闲连接时新建
+func (t *smtpTransport) get() (*smtpConn, bool, error) {
+	for {
+		t.mu.Lock()
+		if len(t.idle) == 0 {
+			t.mu.Unlock()
+			break
+		}
+		conn := t.idle[len(t.idle)-1]
+		t.idle = t.idle[:len(t.idle)-1]
+		t.mu.Unlock()
+
+		// 空闲太久或已失效的连接直接丢弃
+		if time.Since(conn.lastUsed) > smtpIdleTimeout || conn.client.Noop() != nil {
+			conn.client.Close()
+			continue
+		}
+		return conn, true, nil
+	}
+
+	conn, err := t.dial()
+	return conn, false, err
+}
+
+// put 归还连接，超出连接池大小时关闭
+func (t *smtpTransport) put(conn *smtpConn) {
+	conn.lastUsed = time.Now()
+
+	t.mu.Lock()
+	if len(t.idle) < t.config.PoolSize {
+		t.idle = append(t.idle, conn)
+		t.mu.Unlock()
+		return
+	}
+	t.mu.Unlock()
+
+	conn.client.Quit()
+}
+
+// dial 建立连接，按TLS模式完成加密协商，配置了用户名时进行认证
+func (t *smtpTransport) dial() (*smtpConn, error) {
+	host := t.config.SMTPHost
+	addr := net.JoinHostPort(host, strconv.Itoa(t.config.SMTPPort))
+	tlsConfig := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: t.config.SkipVerify,
+	}
+
+	dialer := &net.Dialer{Timeout: smtpDialTimeout}
+	var conn net.Conn
+	var err error
+	if t.config.TLSMode == config.SMTPTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", addr, err)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("smtp handshake with %s: %w", addr, err)
+	}
+
+	if t.config.TLSMode == config.SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("%s does not support STARTTLS, set SMTP_TLS_MODE=implicit or none", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("starttls with %s: %w", addr, err)
+		}
+	}
+
+	if t.config.SMTPEmail != "" {
+		auth, err := t.auth(client)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		if err := client.Auth(auth); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("smtp auth as %s: %w", t.config.SMTPEmail, err)
+		}
+	}
+
+	return &smtpConn{client: client, lastUsed: time.Now()}, nil
+}
+
+// auth 根据服务器支持的机制选择认证方式
+func (t *smtpTransport) auth(client *smtp.Client) (smtp.Auth, error) {
+	ok, mechanisms := client.Extension("AUTH")
+	if !ok {
+		return nil, fmt.Errorf("%s does not support AUTH, leave SMTP_EMAIL and SMTP_PASSWORD empty for an unauthenticated relay", t.config.SMTPHost)
+	}
+
+	switch {
+	case strings.Contains(mechanisms, "CRAM-MD5"):
+		return smtp.CRAMMD5Auth(t.config.SMTPEmail, t.config.SMTPPassword), nil
+	case strings.Contains(mechanisms, "PLAIN"):
+		return smtp.PlainAuth("", t.config.SMTPEmail, t.config.SMTPPassword, t.config.SMTPHost), nil
+	case strings.Contains(mechanisms, "LOGIN"):
+		return &loginAuth{username: t.config.SMTPEmail, password: t.config.SMTPPassword}, nil
+	}
+	return nil, fmt.Errorf("%s offers no supported AUTH mechanism (%s)", t.config.SMTPHost, mechanisms)
+}
+
+// deliver 在连接上发送一封邮件，成功后重置会话以便复用
+func (t *smtpTransport) deliver(conn *smtpConn, from string, to []string, m *gomail.Message) error {
+	if err := conn.client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := conn.client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := conn.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := m.WriteTo(w); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return conn.client.Reset()
+}
+
+// isConnectionError 判断错误是否由连接断开引起
+// 服务器返回的SMTP错误码说明连接仍然可用，换用新连接重试也不会成功
+func isConnectionError(err error) bool {
+	var protoErr *textproto.Error
+	return !errors.As(err, &protoErr)
+}
+
+// loginAuth 实现LOGIN认证机制，部分服务器（如Office 365）只支持这种方式
+type loginAuth struct {
+	username string
+	password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected server challenge %q", fromServer)
+}
+
+// isLocalhost 判断是否为本机地址，net/smtp同样只允许向本机明文发送密码
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"time"
+
+	"checkin-system/models"
+
+	"gorm.io/gorm"
+)
+
+// streakInitialWindow 计算连续签到天数时首次加载的天数，连续签到更长时逐次翻倍
+const streakInitialWindow = 32
+
+// ConsecutiveDays 计算用户当前的连续签到天数
+// 从最近的签到记录开始按需向前加载，直到连续签到中断或没有更早的记录
+func ConsecutiveDays(db *gorm.DB, userID uint, pauses []models.CheckInPause, loc *time.Location) (int, error) {
+	today, _ := models.DayBounds(time.Now(), loc)
+
+	for days := streakInitialWindow; ; days *= 2 {
+		since := today.AddDate(0, 0, -days)
+
+		var checkIns []models.CheckIn
+		if err := db.Select("checkin_at").
+			Where("user_id = ? AND checkin_at >= ?", userID, since).
+			Find(&checkIns).Error; err != nil {
+			return 0, err
+		}
+
+		consecutive, complete := models.ConsecutiveDaysSince(checkIns, pauses, loc, since)
+		if complete {
+			return consecutive, nil
+		}
+
+		var earlier int64
+		if err := db.Model(&models.CheckIn{}).
+			Where("user_id = ? AND checkin_at < ?", userID, since).
+			Count(&earlier).Error; err != nil {
+			return 0, err
+		}
+		if earlier == 0 {
+			return consecutive, nil
+		}
+	}
+}
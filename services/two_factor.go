@@ -0,0 +1,399 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"checkin-system/models"
+
+	"gorm.io/gorm"
+)
+
+// 两步验证参数，与常见验证器（Google Authenticator等）的默认值一致
+const (
+	totpDigits           = 6
+	totpPeriod           = 30               // 每个动态码的有效秒数
+	totpSkew             = 1                // 允许前后各一个时间步的时钟偏差
+	recoveryCodeCount    = 10               // 每次生成的恢复码数量
+	twoFactorMaxAttempts = 5                // 连续输错的次数上限
+	twoFactorLockout     = 15 * time.Minute // 达到上限后锁定的时长，从最后一次输错开始计算
+)
+
+var (
+	// ErrTwoFactorNotSetUp 尚未生成两步验证密钥
+	ErrTwoFactorNotSetUp = errors.New("two-factor authentication has not been set up")
+	// ErrTwoFactorEnabled 两步验证已经开启
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTwoFactorDisabled 两步验证未开启
+	ErrTwoFactorDisabled = errors.New("two-factor authentication is not enabled")
+	// ErrInvalidTwoFactorCode 动态码或恢复码不正确
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	// ErrTwoFactorLocked 输错次数过多，暂时锁定
+	ErrTwoFactorLocked = errors.New("too many invalid two-factor codes, please try again later")
+)
+
+// totpEncoding 密钥使用不带填充的base32编码，与otpauth URI的要求一致
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// recoveryEncoding 恢复码使用小写base32字符，字母表中没有0和1，不会与o、l混淆
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// TwoFactorSetup 开启两步验证时展示给用户的密钥
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`      // 无法扫码时手动输入的密钥
+	OTPAuthURL string `json:"otpauth_url"` // 验证器扫码使用的otpauth URI
+}
+
+// TwoFactorService 基于TOTP（RFC 6238）的两步验证服务
+// 密钥使用遗言消息的加密密钥加密存储，恢复码只保存哈希值
+type TwoFactorService struct {
+	db     *gorm.DB
+	cipher *VaultCipher
+	issuer string
+}
+
+// NewTwoFactorService 创建两步验证服务，issuer显示在验证器中
+func NewTwoFactorService(db *gorm.DB, cipher *VaultCipher, issuer string) *TwoFactorService {
+	return &TwoFactorService{
+		db:     db,
+		cipher: cipher,
+		issuer: issuer,
+	}
+}
+
+// Setup 生成新的密钥，保存为待确认状态，用户用验证器扫码后通过Enable确认
+// 重复调用会替换之前未确认的密钥
+func (s *TwoFactorService) Setup(user *models.User) (*TwoFactorSetup, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	secret := totpEncoding.EncodeToString(raw)
+
+	encrypted, err := s.cipher.Encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	result := s.db.Model(&models.User{}).
+		Where("id = ? AND totp_enabled = ?", user.ID, false).
+		Update("totp_secret", encrypted)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrTwoFactorEnabled
+	}
+	user.TOTPSecret = encrypted
+
+	return &TwoFactorSetup{
+		Secret:     secret,
+		OTPAuthURL: s.otpauthURL(user.Username, secret),
+	}, nil
+}
+
+// Enable 校验验证器生成的动态码，正确时开启两步验证并返回新的恢复码
+func (s *TwoFactorService) Enable(user *models.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotSetUp
+	}
+
+	step, ok, err := s.checkTOTP(user, strings.TrimSpace(code))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, records, err := generateRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := s.db.Begin()
+
+	result := tx.Model(&models.User{}).
+		Where("id = ? AND totp_enabled = ?", user.ID, false).
+		Updates(map[string]interface{}{
+			"totp_enabled":         true,
+			"totp_last_step":       step,
+			"totp_failed_attempts": 0,
+		})
+	if result.Error != nil {
+		tx.Rollback()
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return nil, ErrTwoFactorEnabled
+	}
+
+	if err := replaceRecoveryCodes(tx, user.ID, records); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	return codes, nil
+}
+
+// Verify 校验动态码或恢复码，用于登录和关闭两步验证等敏感操作
+// 用过的动态码和恢复码都不能再次使用，连续输错多次后暂时锁定
+func (s *TwoFactorService) Verify(user *models.User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrTwoFactorDisabled
+	}
+	if user.TOTPFailedAttempts >= twoFactorMaxAttempts && time.Since(user.TOTPLastFailedAt) < twoFactorLockout {
+		return ErrTwoFactorLocked
+	}
+
+	code = strings.TrimSpace(code)
+	var ok bool
+	var err error
+	if isTOTPCode(code) {
+		ok, err = s.useTOTP(user, code)
+	} else {
+		ok, err = s.useRecoveryCode(user, code)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		s.recordFailure(user)
+		return ErrInvalidTwoFactorCode
+	}
+
+	if user.TOTPFailedAttempts > 0 {
+		user.TOTPFailedAttempts = 0
+		if err := s.db.Model(user).Update("totp_failed_attempts", 0).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Disable 关闭两步验证，删除密钥和所有恢复码，调用方需要先通过Verify确认
+func (s *TwoFactorService) Disable(user *models.User) error {
+	tx := s.db.Begin()
+
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"totp_enabled":         false,
+		"totp_secret":          "",
+		"totp_last_step":       0,
+		"totp_failed_attempts": 0,
+	}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// RegenerateRecoveryCodes 生成新的恢复码，之前的恢复码全部作废
+func (s *TwoFactorService) RegenerateRecoveryCodes(user *models.User) ([]string, error) {
+	if !user.TOTPEnabled {
+		return nil, ErrTwoFactorDisabled
+	}
+
+	codes, records, err := generateRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := s.db.Begin()
+	if err := replaceRecoveryCodes(tx, user.ID, records); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RemainingRecoveryCodes 返回用户未使用的恢复码数量
+func (s *TwoFactorService) RemainingRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := s.db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// otpauthURL 生成验证器扫码使用的otpauth URI
+func (s *TwoFactorService) otpauthURL(account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", s.issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(s.issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// checkTOTP 校验动态码，返回匹配的时间步，已经使用过的时间步不再接受
+func (s *TwoFactorService) checkTOTP(user *models.User, code string) (int64, bool, error) {
+	if !isTOTPCode(code) {
+		return 0, false, nil
+	}
+
+	secret, err := s.cipher.Decrypt(user.TOTPSecret)
+	if err != nil {
+		return 0, false, err
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		return 0, false, err
+	}
+
+	current := time.Now().Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= user.TOTPLastStep {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// useTOTP 校验动态码并记录使用的时间步，并发提交同一个动态码时只有一个请求能成功
+func (s *TwoFactorService) useTOTP(user *models.User, code string) (bool, error) {
+	step, ok, err := s.checkTOTP(user, code)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	result := s.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	user.TOTPLastStep = step
+	return true, nil
+}
+
+// useRecoveryCode 将恢复码标记为已使用，恢复码不存在或已使用时返回false
+func (s *TwoFactorService) useRecoveryCode(user *models.User, code string) (bool, error) {
+	normalized := models.NormalizeRecoveryCode(code)
+	if normalized == "" {
+		return false, nil
+	}
+
+	result := s.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, models.HashToken(normalized)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// recordFailure 记录一次输错，上次输错已超过锁定时长时重新计数
+func (s *TwoFactorService) recordFailure(user *models.User) {
+	attempts := user.TOTPFailedAttempts + 1
+	if time.Since(user.TOTPLastFailedAt) >= twoFactorLockout {
+		attempts = 1
+	}
+
+	user.TOTPFailedAttempts = attempts
+	user.TOTPLastFailedAt = time.Now()
+	s.db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"totp_failed_attempts": user.TOTPFailedAttempts,
+		"totp_last_failed_at":  user.TOTPLastFailedAt,
+	})
+}
+
+// isTOTPCode 判断输入是否为动态码格式（6位数字），否则按恢复码处理
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// totpCode 按RFC 4226计算指定时间步的动态码
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// generateRecoveryCodes 生成一组恢复码，返回展示给用户的明文和待保存的哈希记录
+// 每个恢复码包含60位随机数，格式为 xxxx-xxxx-xxxx
+func generateRecoveryCodes(userID uint) ([]string, []models.RecoveryCode, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 8)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		code := recoveryEncoding.EncodeToString(raw)[:12]
+
+		codes = append(codes, code[:4]+"-"+code[4:8]+"-"+code[8:])
+		records = append(records, models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: models.HashToken(code),
+		})
+	}
+	return codes, records, nil
+}
+
+// replaceRecoveryCodes 删除用户原有的恢复码并保存新的恢复码
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, records []models.RecoveryCode) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	return tx.Create(&records).Error
+}
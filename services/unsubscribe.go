@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+
+	"checkin-system/config"
+)
+
+// ErrInvalidUnsubscribeToken 退订令牌格式错误或签名不正确
+var ErrInvalidUnsubscribeToken = errors.New("invalid unsubscribe token")
+
+// UnsubscribeClaims 退订令牌中携带的信息
+// ReminderID不为0时退订该条提醒，否则退订Event对应的通知类别
+type UnsubscribeClaims struct {
+	UserID     uint
+	ReminderID uint
+	Event      string
+}
+
+// UnsubscribeService 退订链接服务，生成并校验带签名的退订令牌
+// 令牌不过期，邮件客户端可能在很久之后才使用List-Unsubscribe头
+type UnsubscribeService struct {
+	baseURL string
+	signer  tokenSigner
+}
+
+// NewUnsubscribeService 创建退订链接服务
+func NewUnsubscribeService(appConfig config.AppConfig) *UnsubscribeService {
+	return &UnsubscribeService{
+		baseURL: appConfig.BaseURL,
+		signer:  tokenSigner{purpose: "unsubscribe", secret: []byte(appConfig.LinkSecret)},
+	}
+}
+
+// GenerateURL 生成退订链接，同一个地址既可以在浏览器中打开确认页面，也可以直接POST完成一键退订（RFC 8058）
+func (s *UnsubscribeService) GenerateURL(claims UnsubscribeClaims) string {
+	return s.baseURL + "/api/unsubscribe?token=" + url.QueryEscape(s.sign(claims))
+}
+
+// Parse 校验令牌签名并返回其中的信息
+func (s *UnsubscribeService) Parse(token string) (*UnsubscribeClaims, error) {
+	fields, ok := s.signer.verify(token, 3)
+	if !ok {
+		return nil, ErrInvalidUnsubscribeToken
+	}
+
+	userID, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidUnsubscribeToken
+	}
+
+	reminderID, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidUnsubscribeToken
+	}
+
+	return &UnsubscribeClaims{
+		UserID:     uint(userID),
+		ReminderID: uint(reminderID),
+		Event:      fields[2],
+	}, nil
+}
+
+// sign 生成退订令牌
+func (s *UnsubscribeService) sign(claims UnsubscribeClaims) string {
+	return s.signer.sign(
+		strconv.FormatUint(uint64(claims.UserID), 10),
+		strconv.FormatUint(uint64(claims.ReminderID), 10),
+		claims.Event,
+	)
+}
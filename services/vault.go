@@ -0,0 +1,229 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"time"
+
+	"checkin-system/models"
+
+	"gorm.io/gorm"
+)
+
+// VaultCipher 遗言消息加解密
+type VaultCipher struct {
+	aead cipher.AEAD
+}
+
+// NewVaultCipher 创建遗言消息加解密器，密钥由配置的字符串经SHA-256派生
+func NewVaultCipher(secret string) (*VaultCipher, error) {
+	if secret == "" {
+		return nil, errors.New("vault key is empty")
+	}
+
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VaultCipher{aead: aead}, nil
+}
+
+// Encrypt 加密明文，返回base64(nonce+密文)
+func (v *VaultCipher) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := v.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密Encrypt生成的密文
+func (v *VaultCipher) Decrypt(ciphertext string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	nonceSize := v.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", errors.New("vault ciphertext is too short")
+	}
+
+	plaintext, err := v.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// checkVaultReleases 检查并释放满足条件的遗言消息
+func (s *SchedulerService) checkVaultReleases() {
+	log.Println("Checking vault releases...")
+
+	var messages []models.VaultMessage
+	if err := s.db.Preload("Recipients").
+		Where("status = ?", models.VaultStatusActive).
+		Order("user_id ASC").
+		Find(&messages).Error; err != nil {
+		log.Printf("Error fetching vault messages: %v", err)
+		return
+	}
+
+	now := time.Now()
+	silenceByUser := make(map[uint]*time.Time)
+	for _, message := range messages {
+		var user models.User
+		if err := s.db.First(&user, message.UserID).Error; err != nil {
+			log.Printf("Error finding user %d: %v", message.UserID, err)
+			continue
+		}
+
+		silenceSince, ok := silenceByUser[user.ID]
+		if !ok {
+			// 暂停期间的用户不释放任何消息，用nil标记
+			pauses := s.userPauses(user.ID)
+			if models.ActivePause(pauses, now) == nil {
+				since, _ := s.silenceStart(&user, pauses)
+				silenceSince = &since
+			}
+			silenceByUser[user.ID] = silenceSince
+		}
+
+		if silenceSince == nil || now.Sub(*silenceSince) < time.Duration(message.ReleaseAfterDays)*24*time.Hour {
+			continue
+		}
+
+		s.releaseVaultMessage(&message, &user)
+	}
+}
+
+// releaseVaultMessage 向尚未送达的收件人发送遗言消息，全部送达后标记为已释放
+// 邮件由发件箱发送，发送成功后才标记收件人已送达；排队中的收件人会被跳过，
+// 进入死信的邮件会重新入队，因此重复执行是安全的
+func (s *SchedulerService) releaseVaultMessage(message *models.VaultMessage, user *models.User) {
+	plaintext, err := s.vaultCipher.Decrypt(message.EncryptedBody)
+	if err != nil {
+		log.Printf("Error decrypting vault message %d: %v", message.ID, err)
+		s.recordVaultLog(message, 0, "failed", "decrypt: "+err.Error())
+		return
+	}
+
+	allDelivered := true
+	for _, recipient := range message.Recipients {
+		if recipient.DeliveredAt != nil {
+			continue
+		}
+		allDelivered = false
+
+		if recipient.OutboxID != 0 {
+			var queued models.EmailOutbox
+			err := s.db.Select("id", "status", "last_error").First(&queued, recipient.OutboxID).Error
+			if err == nil && queued.Status != models.EmailStatusDead {
+				// 仍在发件箱中等待发送或重试，发送成功后由发件箱任务标记送达
+				continue
+			}
+			if err == nil {
+				s.recordVaultLog(message, recipient.ID, "failed", queued.LastError)
+			}
+		}
+
+		n := &Notification{
+			Event:     models.NotificationEventVaultRelease,
+			User:      user,
+			Template:  "vault_release",
+			Data:      VaultMessageData(&recipient, user, message.Title, plaintext),
+			Target:    recipient.Email,
+			Sensitive: true,
+		}
+		if err := s.notifier.Dispatch(n); err != nil {
+			log.Printf("Error delivering vault message %d to recipient %d: %v", message.ID, recipient.ID, err)
+			s.recordVaultLog(message, recipient.ID, "failed", err.Error())
+			continue
+		}
+
+		if err := s.db.Model(&models.VaultRecipient{}).Where("id = ?", recipient.ID).Update("outbox_id", n.OutboxID).Error; err != nil {
+			log.Printf("Error recording outbox email of vault recipient %d: %v", recipient.ID, err)
+		}
+		s.recordVaultLog(message, recipient.ID, "queued", recipient.Email)
+	}
+
+	if !allDelivered {
+		return
+	}
+
+	now := time.Now()
+	result := s.db.Model(&models.VaultMessage{}).
+		Where("id = ? AND status = ?", message.ID, models.VaultStatusActive).
+		Updates(map[string]interface{}{"status": models.VaultStatusReleased, "released_at": now})
+	if result.Error != nil {
+		log.Printf("Error marking vault message %d as released: %v", message.ID, result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		s.recordVaultLog(message, 0, "released", "")
+		log.Printf("Released vault message %d of user %s", message.ID, user.Username)
+	}
+}
+
+// markVaultRecipientDelivered 遗言邮件发送成功后标记对应的收件人已送达
+// 所有收件人送达后，下一次检查时遗言消息被标记为已释放
+func (e *EmailService) markVaultRecipientDelivered(outboxID uint, sentAt time.Time) {
+	var recipient models.VaultRecipient
+	if err := e.db.Where("outbox_id = ?", outboxID).First(&recipient).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error finding vault recipient of email %d: %v", outboxID, err)
+		}
+		return
+	}
+
+	result := e.db.Model(&models.VaultRecipient{}).
+		Where("id = ? AND delivered_at IS NULL", recipient.ID).
+		Update("delivered_at", sentAt)
+	if result.Error != nil {
+		log.Printf("Error marking vault recipient %d as delivered: %v", recipient.ID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	entry := models.VaultReleaseLog{
+		MessageID:   recipient.MessageID,
+		UserID:      recipient.UserID,
+		RecipientID: recipient.ID,
+		Event:       "delivered",
+		Detail:      recipient.Email,
+	}
+	if err := e.db.Create(&entry).Error; err != nil {
+		log.Printf("Error recording vault log of message %d: %v", recipient.MessageID, err)
+	}
+}
+
+// recordVaultLog 记录遗言消息释放日志
+func (s *SchedulerService) recordVaultLog(message *models.VaultMessage, recipientID uint, event, detail string) {
+	entry := models.VaultReleaseLog{
+		MessageID:   message.ID,
+		UserID:      message.UserID,
+		RecipientID: recipientID,
+		Event:       event,
+		Detail:      detail,
+	}
+	if err := s.db.Create(&entry).Error; err != nil {
+		log.Printf("Error recording vault log of message %d: %v", message.ID, err)
+	}
+}
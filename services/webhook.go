@@ -0,0 +1,329 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"checkin-system/models"
+
+	"gorm.io/gorm"
+)
+
+// webhook投递请求头
+const (
+	WebhookEventHeader     = "X-Checkin-Event"
+	WebhookDeliveryHeader  = "X-Checkin-Delivery"
+	WebhookTimestampHeader = "X-Checkin-Timestamp"
+	WebhookSignatureHeader = "X-Checkin-Signature" // sha256=HMAC-SHA256(secret, timestamp + "." + body)
+)
+
+const (
+	webhookMaxAttempts = 8                // 最多投递次数，用尽后标记为失败
+	webhookBaseBackoff = 30 * time.Second // 第一次重试的间隔，之后每次翻倍
+	webhookMaxBackoff  = 6 * time.Hour    // 重试间隔上限
+	webhookClaimLease  = 5 * time.Minute  // 投递中的记录在此期间不会被再次领取
+)
+
+// WebhookService 出站webhook的记录和投递，webhook端点的事件和webhook通知渠道的通知都由它签名、投递和重试
+// 只能连接公网地址，防止用户提供的地址被用来访问内网
+type WebhookService struct {
+	db     *gorm.DB
+	client *http.Client
+}
+
+// NewWebhookService 创建webhook服务
+func NewWebhookService(db *gorm.DB) *WebhookService {
+	return &WebhookService{
+		db:     db,
+		client: NewPublicHTTPClient(10 * time.Second),
+	}
+}
+
+// webhookTarget 一次投递的目标地址和签名密钥，来自webhook端点或webhook通知渠道
+type webhookTarget struct {
+	URL    string
+	Secret string
+}
+
+// webhookEvent webhook请求体
+type webhookEvent struct {
+	ID        string                 `json:"id"`
+	Event     string                 `json:"event"`
+	UserID    uint                   `json:"user_id"`
+	CreatedAt time.Time              `json:"created_at"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// GenerateWebhookSecret 生成webhook签名密钥
+func GenerateWebhookSecret() (string, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + secret, nil
+}
+
+// SignWebhookPayload 计算webhook签名，接收方用相同方式计算并比对请求头中的签名
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Emit 为用户订阅了该事件的每个端点记录一次投递并立即尝试发送
+// 投递失败不影响调用方，由DeliverDue按退避策略重试
+func (s *WebhookService) Emit(userID uint, event string, data map[string]interface{}) {
+	var endpoints []models.WebhookEndpoint
+	if err := s.db.Where("user_id = ? AND is_enabled = ?", userID, true).Find(&endpoints).Error; err != nil {
+		log.Printf("Error fetching webhook endpoints of user %d: %v", userID, err)
+		return
+	}
+
+	now := time.Now()
+	for _, endpoint := range endpoints {
+		if !endpoint.Accepts(event) {
+			continue
+		}
+
+		deliveryID, err := randomHex(16)
+		if err != nil {
+			log.Printf("Error generating webhook delivery id: %v", err)
+			continue
+		}
+
+		payload, err := json.Marshal(webhookEvent{
+			ID:        deliveryID,
+			Event:     event,
+			UserID:    userID,
+			CreatedAt: now,
+			Data:      data,
+		})
+		if err != nil {
+			log.Printf("Error encoding %s webhook payload: %v", event, err)
+			continue
+		}
+
+		// 创建时即领取，避免与定时重试同时投递
+		delivery := models.WebhookDelivery{
+			EndpointID:    endpoint.ID,
+			UserID:        userID,
+			DeliveryID:    deliveryID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: now.Add(webhookClaimLease),
+		}
+		if err := s.db.Create(&delivery).Error; err != nil {
+			log.Printf("Error recording webhook delivery for endpoint %d: %v", endpoint.ID, err)
+			continue
+		}
+
+		go s.attempt(delivery, webhookTarget{URL: endpoint.URL, Secret: endpoint.Secret})
+	}
+}
+
+// EnqueueChannel 记录一次到webhook通知渠道的投递并立即尝试发送，失败时由DeliverDue按退避策略重试
+// 渠道还没有签名密钥时（升级前创建的渠道）先生成一个
+func (s *WebhookService) EnqueueChannel(channel *models.NotificationChannel, event string, payload []byte) error {
+	if channel.Secret == "" {
+		secret, err := GenerateWebhookSecret()
+		if err != nil {
+			return err
+		}
+		if err := s.db.Model(&models.NotificationChannel{}).
+			Where("id = ? AND (secret IS NULL OR secret = ?)", channel.ID, "").
+			Update("secret", secret).Error; err != nil {
+			return err
+		}
+		if err := s.db.Select("secret").First(channel, channel.ID).Error; err != nil {
+			return err
+		}
+	}
+
+	deliveryID, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+
+	// 创建时即领取，避免与定时重试同时投递
+	delivery := models.WebhookDelivery{
+		ChannelID:     channel.ID,
+		UserID:        channel.UserID,
+		DeliveryID:    deliveryID,
+		Event:         event,
+		Payload:       string(payload),
+		Status:        models.WebhookDeliveryPending,
+		NextAttemptAt: time.Now().Add(webhookClaimLease),
+	}
+	if err := s.db.Create(&delivery).Error; err != nil {
+		return err
+	}
+
+	go s.attempt(delivery, webhookTarget{URL: channel.Target, Secret: channel.Secret})
+	return nil
+}
+
+// DeliverDue 领取并投递所有到期的待投递记录
+func (s *WebhookService) DeliverDue() {
+	now := time.Now()
+
+	var deliveries []models.WebhookDelivery
+	err := s.db.Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, now).
+		Order("next_attempt_at ASC").
+		Limit(100).
+		Find(&deliveries).Error
+	if err != nil {
+		log.Printf("Error fetching due webhook deliveries: %v", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		// 条件更新领取记录，已被其他任务领取时跳过
+		result := s.db.Model(&models.WebhookDelivery{}).
+			Where("id = ? AND status = ? AND next_attempt_at <= ?", delivery.ID, models.WebhookDeliveryPending, now).
+			Update("next_attempt_at", now.Add(webhookClaimLease))
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		target, ok := s.deliveryTarget(&delivery)
+		if !ok {
+			s.db.Model(&delivery).Updates(map[string]interface{}{
+				"status":     models.WebhookDeliveryFailed,
+				"last_error": "endpoint deleted or disabled",
+			})
+			continue
+		}
+
+		s.attempt(delivery, target)
+	}
+}
+
+// deliveryTarget 查找投递记录当前的目标，端点或渠道已删除、停用时返回false
+func (s *WebhookService) deliveryTarget(delivery *models.WebhookDelivery) (webhookTarget, bool) {
+	if delivery.ChannelID != 0 {
+		var channel models.NotificationChannel
+		if err := s.db.First(&channel, delivery.ChannelID).Error; err != nil || !channel.IsEnabled ||
+			channel.Type != models.NotificationChannelWebhook {
+			return webhookTarget{}, false
+		}
+		return webhookTarget{URL: channel.Target, Secret: channel.Secret}, true
+	}
+
+	var endpoint models.WebhookEndpoint
+	if err := s.db.First(&endpoint, delivery.EndpointID).Error; err != nil || !endpoint.IsEnabled {
+		return webhookTarget{}, false
+	}
+	return webhookTarget{URL: endpoint.URL, Secret: endpoint.Secret}, true
+}
+
+// attempt 投递一次并记录结果，失败时按指数退避安排下一次重试
+func (s *WebhookService) attempt(delivery models.WebhookDelivery, target webhookTarget) {
+	statusCode, err := s.post(&delivery, target)
+
+	now := time.Now()
+	delivery.Attempts++
+	updates := map[string]interface{}{
+		"attempts":         delivery.Attempts,
+		"last_status_code": statusCode,
+	}
+
+	if err == nil {
+		updates["status"] = models.WebhookDeliverySucceeded
+		updates["delivered_at"] = now
+		updates["last_error"] = ""
+	} else {
+		// 用户可以查看投递记录，只保存粗略的失败原因，详细错误只写入日志
+		updates["last_error"] = deliveryErrorMessage(statusCode, err)
+
+		if delivery.Attempts >= webhookMaxAttempts {
+			updates["status"] = models.WebhookDeliveryFailed
+		} else {
+			updates["next_attempt_at"] = now.Add(exponentialBackoff(webhookBaseBackoff, webhookMaxBackoff, delivery.Attempts))
+		}
+		log.Printf("Error delivering webhook %s (endpoint %d, channel %d, attempt %d): %v",
+			delivery.DeliveryID, delivery.EndpointID, delivery.ChannelID, delivery.Attempts, err)
+	}
+
+	if err := s.db.Model(&delivery).Updates(updates).Error; err != nil {
+		log.Printf("Error updating webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// post 签名并发送请求，返回响应状态码
+func (s *WebhookService) post(delivery *models.WebhookDelivery, target webhookTarget) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequest(http.MethodPost, target.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "checkin-system-webhook")
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, delivery.DeliveryID)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(target.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// deliveryErrorMessage 返回可以展示给用户的失败原因
+// 不包含连接错误的细节（解析结果、拒绝连接还是超时等），避免投递记录被用来探测网络
+func deliveryErrorMessage(statusCode int, err error) string {
+	if statusCode != 0 {
+		return fmt.Sprintf("endpoint responded with status %d", statusCode)
+	}
+	if errors.Is(err, ErrNonPublicAddress) {
+		return ErrNonPublicAddress.Error()
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "request timed out"
+	}
+	return "request failed"
+}
+
+// exponentialBackoff 第n次失败后的重试间隔：base、2*base、4*base……不超过max
+func exponentialBackoff(base, max time.Duration, attempts int) time.Duration {
+	backoff := base
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= max {
+			return max
+		}
+	}
+	return backoff
+}
+
+// randomHex 生成n字节的随机十六进制字符串
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -16,27 +16,58 @@ fi
 echo "检测到操作系统: $OS"
 echo ""
 
-# 生成Session密钥
-echo "🔐 生成Session密钥..."
-if command -v openssl &> /dev/null; then
-    SESSION_SECRET=$(openssl rand -base64 32 | tr '+/' '-_' | tr -d '=')
-    echo "✅ 使用OpenSSL生成密钥成功"
-elif [ -f /dev/urandom ]; then
-    SESSION_SECRET=$(head -c 32 /dev/urandom | base64 | tr '+/' '-_' | tr -d '=')
-    echo "✅ 使用 /dev/urandom 生成密钥成功"
-else
-    SESSION_SECRET=$(date +%s%N | sha256sum | head -c 32)
-    echo "✅ 使用备用方法生成密钥成功"
-fi
+# generate_secret 生成一个URL安全的随机密钥
+generate_secret() {
+    if command -v openssl &> /dev/null; then
+        openssl rand -base64 32 | tr '+/' '-_' | tr -d '='
+    elif [ -f /dev/urandom ]; then
+        head -c 32 /dev/urandom | base64 | tr '+/' '-_' | tr -d '='
+    else
+        echo "$(date +%s%N)$RANDOM$1" | sha256sum | head -c 32
+    fi
+}
 
-echo "密钥: $SESSION_SECRET"
+# 生成Session密钥和加密密钥，各密钥必须互不相同
+echo "🔐 生成Session密钥和加密密钥..."
+SESSION_SECRET=$(generate_secret session)
+VAULT_KEY=$(generate_secret vault)
+LINK_SECRET=$(generate_secret link)
+echo "✅ 密钥生成成功"
 echo ""
 
 # 检查并创建.env文件
 if [ -f ".env" ]; then
     echo "📝 .env文件已存在"
+
+    # VAULT_KEY更换后已有数据无法解密，已配置时保持不变
+    # 以前未设置VAULT_KEY的部署使用SESSION_SECRET加密，沿用原SESSION_SECRET作为VAULT_KEY
+    if ! grep -q "^VAULT_KEY=" .env; then
+        OLD_SESSION_SECRET=$(grep "^SESSION_SECRET=" .env | head -n 1 | cut -d= -f2-)
+        if [ -n "$OLD_SESSION_SECRET" ]; then
+            VAULT_KEY=$OLD_SESSION_SECRET
+            echo "正在把原SESSION_SECRET设为VAULT_KEY..."
+        else
+            echo "正在添加VAULT_KEY..."
+        fi
+        echo "" >> .env
+        echo "# 遗言消息和两步验证密钥的加密密钥，更换后已有数据将无法解密" >> .env
+        echo "VAULT_KEY=$VAULT_KEY" >> .env
+    fi
+
+    if ! grep -q "^LINK_SECRET=" .env; then
+        echo "正在添加LINK_SECRET..."
+        echo "" >> .env
+        echo "# 邮件中签到、退订链接的签名密钥" >> .env
+        echo "LINK_SECRET=$LINK_SECRET" >> .env
+    fi
+
+    if ! grep -q "^APP_ENV=" .env; then
+        echo "" >> .env
+        echo "# 运行环境：production（默认）或 development（允许省略VAULT_KEY和LINK_SECRET，并启用开发辅助页面）" >> .env
+        echo "APP_ENV=production" >> .env
+    fi
+
     echo "正在更新SESSION_SECRET..."
-    
     # 更新SESSION_SECRET
     if grep -q "SESSION_SECRET=" .env; then
         sed -i "s/SESSION_SECRET=.*/SESSION_SECRET=$SESSION_SECRET/" .env
@@ -58,6 +89,15 @@ DB_NAME=checkin_system
 # Session配置
 SESSION_SECRET=$SESSION_SECRET
 
+# 遗言消息和两步验证密钥的加密密钥，更换后已有数据将无法解密
+VAULT_KEY=$VAULT_KEY
+
+# 邮件中签到、退订链接的签名密钥
+LINK_SECRET=$LINK_SECRET
+
+# 运行环境：production（默认）或 development（允许省略VAULT_KEY和LINK_SECRET，并启用开发辅助页面）
+APP_ENV=production
+
 # 邮件配置
 SMTP_HOST=smtp.gmail.com
 SMTP_PORT=587
@@ -95,5 +135,5 @@ echo ""
 echo "💡 重要提示:"
 echo "- 请修改 DB_PASSWORD 为实际的数据库密码"
 echo "- 请配置 SMTP_EMAIL 和 SMTP_PASSWORD"
-echo "- 生产环境请使用更复杂的SESSION_SECRET"
+echo "- 请妥善备份 VAULT_KEY，丢失或更换后已保存的遗言消息和两步验证将无法解密"
 echo ""
\ No newline at end of file
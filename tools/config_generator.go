@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -17,8 +18,28 @@ func generateRandomString(length int) string {
 	return base64.URLEncoding.EncodeToString(bytes)
 }
 
-func generateConfig() {
-	jwtSecret := generateRandomString(32)
+// jwtSection 返回JWT配置段，默认只写入注释，保持只使用Session登录
+func jwtSection(jwtSecret string) string {
+	if jwtSecret == "" {
+		return `# JWT配置（可选，取消下面的注释并填写至少32个字节的密钥即开启JWT模式，可用 go run config_generator.go -jwt 生成）
+# JWT_SECRET=
+# JWT_ACCESS_TTL=15m
+# JWT_REFRESH_TTL=720h`
+	}
+	return fmt.Sprintf(`# JWT配置（删除JWT_SECRET即关闭JWT模式，只使用Session登录）
+JWT_SECRET=%s
+JWT_ACCESS_TTL=15m
+JWT_REFRESH_TTL=720h`, jwtSecret)
+}
+
+func generateConfig(withJWT bool) {
+	sessionSecret := generateRandomString(32)
+	vaultKey := generateRandomString(32)
+	linkSecret := generateRandomString(32)
+	var jwtSecret string
+	if withJWT {
+		jwtSecret = generateRandomString(32)
+	}
 	
 	// 创建.env配置文件内容
 	configContent := fmt.Sprintf(`# 数据库配置
@@ -28,9 +49,19 @@ DB_USER=postgres
 DB_PASSWORD=password
 DB_NAME=checkin_system
 
-# JWT配置
-JWT_SECRET=%s
-JWT_EXPIRES_IN=24h
+# Session配置
+SESSION_SECRET=%s
+
+# 遗言消息和两步验证密钥的加密密钥，更换后已有数据将无法解密
+VAULT_KEY=%s
+
+# 邮件中签到、退订链接的签名密钥
+LINK_SECRET=%s
+
+# 运行环境：production（默认）或 development（允许省略VAULT_KEY和LINK_SECRET，并启用开发辅助页面）
+APP_ENV=production
+
+%s
 
 # 邮件配置
 SMTP_HOST=smtp.gmail.com
@@ -39,7 +70,7 @@ SMTP_EMAIL=your-email@gmail.com
 SMTP_PASSWORD=your-app-password
 
 # 服务器配置
-SERVER_PORT=8080`, jwtSecret)
+SERVER_PORT=8080`, sessionSecret, vaultKey, linkSecret, jwtSection(jwtSecret))
 
 	// 写入.env文件
 	if err := os.WriteFile("../.env", []byte(configContent), 0644); err != nil {
@@ -48,23 +79,34 @@ SERVER_PORT=8080`, jwtSecret)
 
 	fmt.Println("✅ 配置文件生成成功！")
 	fmt.Println()
-	fmt.Println("JWT_SECRET已自动生成并设置:")
+	fmt.Println("以下密钥已自动生成并设置:")
 	fmt.Printf("%s\n", strings.Repeat("=", 50))
-	fmt.Printf("%s\n", jwtSecret)
+	fmt.Printf("SESSION_SECRET=%s\n", sessionSecret)
+	fmt.Printf("VAULT_KEY=%s\n", vaultKey)
+	fmt.Printf("LINK_SECRET=%s\n", linkSecret)
+	if jwtSecret != "" {
+		fmt.Printf("JWT_SECRET=%s\n", jwtSecret)
+	}
 	fmt.Printf("%s\n", strings.Repeat("=", 50))
 	fmt.Println()
 	fmt.Println("📝 请注意修改以下配置:")
 	fmt.Println("1. 数据库密码 (DB_PASSWORD)")
 	fmt.Println("2. 邮件配置 (SMTP_EMAIL, SMTP_PASSWORD)")
 	fmt.Println("3. 数据库名称 (如果需要) (DB_NAME)")
+	if jwtSecret == "" {
+		fmt.Println("4. 需要JWT模式时使用 -jwt 参数重新生成，或手动设置JWT_SECRET")
+	}
 	fmt.Println()
 	fmt.Println("⚠️  安全提醒:")
-	fmt.Println("- 请将JWT_SECRET保存在安全的地方")
+	fmt.Println("- 请将生成的密钥保存在安全的地方，VAULT_KEY丢失或更换后已保存的遗言消息和两步验证将无法解密")
 	fmt.Println("- 不要将.env文件提交到版本控制系统")
 	fmt.Println("- 生产环境请使用强密码和加密连接")
 }
 
 func main() {
+	withJWT := flag.Bool("jwt", false, "同时生成JWT_SECRET，开启JWT模式")
+	flag.Parse()
+
 	fmt.Println("🔐 签到系统配置生成器")
 	fmt.Println("====================")
 	fmt.Println()
@@ -82,5 +124,5 @@ func main() {
 		}
 	}
 
-	generateConfig()
+	generateConfig(*withJWT)
 }
\ No newline at end of file